@@ -0,0 +1,353 @@
+package delta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nulastudio/NetBeauty/src/util"
+)
+
+// ManifestFile 增量包中的清单文件
+const ManifestFile = "manifest.json"
+
+// FilesDir 增量包中存放新增及修改文件的目录
+const FilesDir = "files"
+
+// ManifestVersion 清单格式版本
+const ManifestVersion = 1
+
+// 应用时暂存新文件及备份旧文件的后缀，全部写入成功后才替换
+const (
+	stageSuffix  = ".nbdelta-new"
+	backupSuffix = ".nbdelta-old"
+)
+
+// SRM模式下以文件内容md5命名的目录
+var hashDirRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// File 清单中的文件，路径相对于应用目录
+type File struct {
+	Path string `json:"path"`
+	// OldHash 旧版本的sha256，新增文件为空
+	OldHash string `json:"oldHash,omitempty"`
+	// Hash 新版本的sha256，删除文件为空
+	Hash string `json:"hash,omitempty"`
+	Size int64  `json:"size,omitempty"`
+}
+
+// Manifest 增量包清单
+type Manifest struct {
+	Version int     `json:"version"`
+	Added   []*File `json:"added"`
+	Changed []*File `json:"changed"`
+	Removed []*File `json:"removed"`
+	// Skipped 新旧版本中都存在的SRM哈希目录，内容由目录名决定，无需比较
+	Skipped []string `json:"skipped"`
+}
+
+// Create 比较新旧两个版本，将清单及新增、修改的文件写入out
+func Create(oldDir string, newDir string, out string) (*Manifest, error) {
+	if files, _ := ioutil.ReadDir(out); len(files) != 0 {
+		return nil, errors.New("out is not empty: " + out)
+	}
+
+	oldPaths, oldFiles, oldHashDirs, err := scan(oldDir)
+	if err != nil {
+		return nil, err
+	}
+	newPaths, newFiles, newHashDirs, err := scan(newDir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Version: ManifestVersion,
+		Added:   make([]*File, 0),
+		Changed: make([]*File, 0),
+		Removed: make([]*File, 0),
+		Skipped: make([]string, 0),
+	}
+
+	skipped := make(map[string]bool)
+	for dir := range newHashDirs {
+		if oldHashDirs[dir] {
+			skipped[dir] = true
+			manifest.Skipped = append(manifest.Skipped, dir)
+		}
+	}
+	sort.Strings(manifest.Skipped)
+
+	for _, path := range newPaths {
+		if inDirs(path, skipped) {
+			continue
+		}
+
+		hash, err := fileHash(filepath.Join(newDir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+
+		file := &File{Path: path, Hash: hash, Size: newFiles[path]}
+
+		if _, ok := oldFiles[path]; ok {
+			oldHash, err := fileHash(filepath.Join(oldDir, filepath.FromSlash(path)))
+			if err != nil {
+				return nil, err
+			}
+			if oldHash == hash {
+				continue
+			}
+			file.OldHash = oldHash
+			manifest.Changed = append(manifest.Changed, file)
+		} else {
+			manifest.Added = append(manifest.Added, file)
+		}
+
+		if _, err := util.CopyFile(filepath.Join(newDir, filepath.FromSlash(path)), filepath.Join(out, FilesDir, filepath.FromSlash(path))); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range oldPaths {
+		if _, ok := newFiles[path]; ok || inDirs(path, skipped) {
+			continue
+		}
+
+		oldHash, err := fileHash(filepath.Join(oldDir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		manifest.Removed = append(manifest.Removed, &File{Path: path, OldHash: oldHash})
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(out, 0777); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(out, ManifestFile), content, 0666); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Apply 校验dir为增量包的旧版本后应用增量包，并校验结果
+// 新文件先暂存在目标旁边，全部写入并校验成功后才替换，替换失败时恢复旧文件
+func Apply(pkg string, dir string) (*Manifest, error) {
+	content, err := ioutil.ReadFile(filepath.Join(pkg, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %s", err.Error())
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version: %d", manifest.Version)
+	}
+
+	// 清单中的路径必须位于应用目录内，先于其它任何检查
+	paths := append([]string{}, manifest.Skipped...)
+	for _, file := range manifest.files() {
+		paths = append(paths, file.Path)
+	}
+	for _, path := range paths {
+		if err := checkPath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	written := append(append([]*File{}, manifest.Added...), manifest.Changed...)
+
+	// 应用前校验，任何不一致都不做修改
+	for _, file := range append(append([]*File{}, manifest.Changed...), manifest.Removed...) {
+		if err := verify(dir, file.Path, file.OldHash); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range manifest.Added {
+		if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(file.Path))); err == nil {
+			return nil, fmt.Errorf("%s: already exists", file.Path)
+		}
+	}
+	for _, skipped := range manifest.Skipped {
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(skipped))); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("%s: missing", skipped)
+		}
+	}
+
+	// 暂存新文件并校验
+	staged := make([]string, 0, len(written))
+	discard := func() {
+		for _, path := range staged {
+			os.Remove(path + stageSuffix)
+			util.RemoveEmptyDirs(dir, filepath.Dir(path))
+		}
+	}
+	for _, file := range written {
+		path := filepath.Join(dir, filepath.FromSlash(file.Path))
+		staged = append(staged, path)
+		if _, err := util.CopyFile(filepath.Join(pkg, FilesDir, filepath.FromSlash(file.Path)), path+stageSuffix); err != nil {
+			discard()
+			return nil, err
+		}
+		if err := verify(dir, file.Path+stageSuffix, file.Hash); err != nil {
+			discard()
+			return nil, fmt.Errorf("corrupted package: %s", err.Error())
+		}
+	}
+
+	// 备份修改及删除的文件，再替换为新文件，任何一步失败都恢复原状
+	backups := make([]string, 0, len(manifest.Changed)+len(manifest.Removed))
+	replaced := make([]string, 0, len(written))
+	rollback := func() {
+		for _, path := range replaced {
+			os.Remove(path)
+		}
+		for _, path := range backups {
+			os.Rename(path+backupSuffix, path)
+		}
+		discard()
+	}
+	for _, file := range append(append([]*File{}, manifest.Changed...), manifest.Removed...) {
+		path := filepath.Join(dir, filepath.FromSlash(file.Path))
+		if err := os.Rename(path, path+backupSuffix); err != nil {
+			rollback()
+			return nil, err
+		}
+		backups = append(backups, path)
+	}
+	for _, path := range staged {
+		if err := os.Rename(path+stageSuffix, path); err != nil {
+			rollback()
+			return nil, err
+		}
+		replaced = append(replaced, path)
+	}
+
+	for _, path := range backups {
+		os.Remove(path + backupSuffix)
+		util.RemoveEmptyDirs(dir, filepath.Dir(path))
+	}
+
+	// 应用后校验
+	for _, file := range written {
+		if err := verify(dir, file.Path, file.Hash); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range manifest.Removed {
+		if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(file.Path))); err == nil {
+			return nil, fmt.Errorf("%s: not removed", file.Path)
+		}
+	}
+
+	return manifest, nil
+}
+
+// files 清单中的所有文件
+func (m *Manifest) files() []*File {
+	return append(append(append([]*File{}, m.Added...), m.Changed...), m.Removed...)
+}
+
+// checkPath 拒绝绝对路径、带卷标的路径及指向应用目录以外的路径
+func checkPath(path string) error {
+	native := filepath.FromSlash(path)
+	clean := filepath.Clean(native)
+	if path == "" || filepath.IsAbs(native) || strings.HasPrefix(path, "/") || filepath.VolumeName(native) != "" ||
+		clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s: invalid path in manifest", path)
+	}
+	return nil
+}
+
+// scan 列出目录下的所有文件（按路径排序）、各文件的大小及SRM哈希目录
+// SRM哈希目录为<name>/<md5>/<name>中的<name>/<md5>（包括locales/<culture>/<name>/<md5>/<name>）
+func scan(dir string) ([]string, map[string]int64, map[string]bool, error) {
+	paths := make([]string, 0)
+	files := make(map[string]int64)
+	hashDirs := make(map[string]bool)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+
+		if !info.IsDir() {
+			paths = append(paths, rel)
+			files[rel] = info.Size()
+			return nil
+		}
+
+		if !hashDirRegex.MatchString(info.Name()) {
+			return nil
+		}
+
+		parent := filepath.Base(filepath.Dir(path))
+		if children, _ := ioutil.ReadDir(path); len(children) == 1 && children[0].Name() == parent && !children[0].IsDir() {
+			hashDirs[rel] = true
+		}
+
+		return nil
+	})
+
+	sort.Strings(paths)
+
+	return paths, files, hashDirs, err
+}
+
+func inDirs(path string, dirs map[string]bool) bool {
+	for dir := path; strings.Contains(dir, "/"); {
+		dir = dir[:strings.LastIndex(dir, "/")]
+		if dirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+func verify(dir string, path string, hash string) error {
+	actual, err := fileHash(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		return err
+	}
+	if actual != hash {
+		return fmt.Errorf("%s: hash mismatch, expected %s, got %s", path, hash, actual)
+	}
+	return nil
+}
+
+func fileHash(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,137 @@
+package delta
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0777)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// snapshot 目录下所有文件的内容
+func snapshot(t *testing.T, dir string) map[string]string {
+	paths, _, _, err := scan(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[path] = string(content)
+	}
+	return files
+}
+
+func setup(t *testing.T) (string, string, string, string) {
+	root, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	pkg := filepath.Join(root, "pkg")
+	app := filepath.Join(root, "app")
+
+	writeFiles(t, oldDir, map[string]string{
+		"App.dll":         "v1",
+		"libs/same.dll":   "same",
+		"libs/gone/x.dll": "gone",
+	})
+	writeFiles(t, newDir, map[string]string{
+		"App.dll":        "v2",
+		"libs/same.dll":  "same",
+		"libs/new/y.dll": "new",
+	})
+	writeFiles(t, app, snapshot(t, oldDir))
+
+	if _, err := Create(oldDir, newDir, pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	return root, app, pkg, newDir
+}
+
+func TestApply(t *testing.T) {
+	root, app, pkg, newDir := setup(t)
+	defer os.RemoveAll(root)
+
+	if _, err := Apply(pkg, app); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := snapshot(t, app), snapshot(t, newDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("applied %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(app, "libs", "gone")); err == nil {
+		t.Error("empty directory not removed")
+	}
+}
+
+func TestApplyTamperedHash(t *testing.T) {
+	root, app, pkg, _ := setup(t)
+	defer os.RemoveAll(root)
+
+	before := snapshot(t, app)
+
+	// 后写入的文件损坏时，已暂存的文件也不能留下
+	writeFiles(t, filepath.Join(pkg, FilesDir), map[string]string{"libs/new/y.dll": "tampered"})
+	if _, err := Apply(pkg, app); err == nil {
+		t.Fatal("tampered package applied")
+	}
+	if after := snapshot(t, app); !reflect.DeepEqual(after, before) {
+		t.Errorf("app changed: %v, want %v", after, before)
+	}
+	if _, err := os.Stat(filepath.Join(app, "libs", "new")); err == nil {
+		t.Error("staging directory left behind")
+	}
+}
+
+func TestApplyRejectsTraversal(t *testing.T) {
+	root, app, pkg, _ := setup(t)
+	defer os.RemoveAll(root)
+
+	content, _ := ioutil.ReadFile(filepath.Join(pkg, ManifestFile))
+	// 包中放入可以通过校验的文件，只有路径检查能阻止写入应用目录以外
+	writeFiles(t, root, map[string]string{"pkg/evil.dll": "evil", "pkg/files/evil.dll": "evil"})
+	hash, _ := fileHash(filepath.Join(pkg, "evil.dll"))
+	before := snapshot(t, root)
+
+	for _, path := range []string{"../evil.dll", "libs/../../evil.dll", "/evil.dll", "..", "", "."} {
+		manifest := &Manifest{}
+		json.Unmarshal(content, manifest)
+		manifest.Added = append(manifest.Added, &File{Path: path, Hash: hash})
+
+		skipped := &Manifest{}
+		json.Unmarshal(content, skipped)
+		skipped.Skipped = append(skipped.Skipped, path)
+
+		for _, m := range []*Manifest{manifest, skipped} {
+			data, _ := json.Marshal(m)
+			ioutil.WriteFile(filepath.Join(pkg, ManifestFile), data, 0666)
+
+			if _, err := Apply(pkg, app); err == nil {
+				t.Errorf("%q: accepted", path)
+			}
+		}
+	}
+
+	ioutil.WriteFile(filepath.Join(pkg, ManifestFile), content, 0666)
+	if after := snapshot(t, root); !reflect.DeepEqual(after, before) {
+		t.Errorf("files changed: %v, want %v", after, before)
+	}
+}
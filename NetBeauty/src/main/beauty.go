@@ -11,9 +11,12 @@ import (
 	"regexp"
 	"strings"
 
+	delta "github.com/nulastudio/NetBeauty/src/delta"
 	log "github.com/nulastudio/NetBeauty/src/log"
 	manager "github.com/nulastudio/NetBeauty/src/manager"
 	misc "github.com/nulastudio/NetBeauty/src/misc"
+	pack "github.com/nulastudio/NetBeauty/src/pack"
+	symbols "github.com/nulastudio/NetBeauty/src/symbols"
 	util "github.com/nulastudio/NetBeauty/src/util"
 )
 
@@ -30,6 +33,19 @@ type depsFileDetail struct {
 	rid        string
 }
 
+// fixedDeps 已修改的deps.json及需要移动的依赖
+type fixedDeps struct {
+	depsFileDetail
+	// original 修改前的内容，冲突时用于恢复
+	original []byte
+	allDeps  []manager.Deps
+	// filtered 被--cultures过滤的卫星程序集，冲突检查通过后才删除
+	filtered []manager.Deps
+	usePatch bool
+	success  bool
+	hidden   bool
+}
+
 type patchedAppHost struct {
 	IsPatched bool
 	AppHost   manager.AppHost
@@ -57,6 +73,40 @@ var isNetFx = false
 var rollForward = ""
 var appHostEntry = ""
 var appHostDir = ""
+var appHostSubsystem = ""
+var fxConfigs = ""
+var rulesFile = ""
+var cultures = ""
+
+// 默认的sidecar模板
+const defaultSidecars = "{base}.pdb;{base}.xml;{base}.dbg;{name}.dbg;{base}.r2rmap;{name}.config;{name}.dSYM/"
+
+var sidecars = defaultSidecars
+var symbolsOut = ""
+
+// 输出目录，不为空时先复制beautyDir再处理副本
+var outDir = ""
+
+// report quarantine
+var orphansPolicy = "report"
+
+// error highest perapp
+var conflictPolicy = "error"
+
+// move copy hardlink symlink reflink
+var linkMode = misc.MoveMode
+
+// 本次运行中放入libsDir的文件（目标 => 源文件），只有它们之间会冲突，上次运行留下的旧文件直接替换
+var placedFiles = make(map[string]string)
+
+// perapp冲突时各应用独有的目录（相对于libsDir），优先于libsDir
+var appLibsDirs = make(map[string][]string)
+
+// 隔离的孤立文件所在目录（相对于beautyDir），不在NetBeautyLibsDir中，不会被加载
+const orphansDir = "orphans"
+
+// 显式指定的.NET Framework配置文件及其libsDir（为空时使用默认libsDir）
+var fxConfigLibsDirs = make(map[string]string)
 
 var gitcdn string
 var gittree string = ""
@@ -70,6 +120,9 @@ func main() {
 
 	// 设置CDN
 	manager.GitCDN = gitcdn
+
+	// 启动钩子的依赖由libloader.dll的程序集引用决定
+	manager.LoaderAssembly, _ = Asset("libloader/libloader.dll")
 	if gittree != "" {
 		manager.GitTree = gittree
 	}
@@ -77,18 +130,40 @@ func main() {
 	log.LogInfo("running nbeauty...")
 
 	subDirs := make([]string, 0)
-	srmMapping := make(map[string]string, 0)
+	// 每个应用的SRM映射（文件 => 哈希目录或卫星程序集目录），键为应用名
+	srmMapping := make(map[string]map[string]string)
 
 	fxrVersion, rid := "", ""
 
-	useWPF := false
+	// 每个应用（deps.json）各自的特征，键为应用名
+	appTraits := make(map[string]manager.AppTraits)
+	// 每个应用的loader依赖，移动文件后无法再次计算
+	appLoaderDeps := make(map[string]map[string]bool)
 
 	exeConfig := manager.FindExeConfig(beautyDir)
 
+	for _, appConfig := range util.SortedKeys(fxConfigLibsDirs) {
+		exists := false
+		for _, c := range exeConfig {
+			if absConfig, _ := filepath.Abs(c); absConfig == appConfig {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			exeConfig = append(exeConfig, appConfig)
+		}
+	}
+
 	if len(exeConfig) != 0 {
 		isNetFx = true
 	}
 
+	// 修改任何文件之前先校验deps.json及runtimeconfig.json
+	if !isNetFx && !validateJSONFiles(manager.FindDepsJSON(beautyDir), manager.FindRuntimeConfigJSON(beautyDir)) {
+		log.LogError(errors.New("malformed deps.json or runtimeconfig.json, nothing has been changed"), true)
+	}
+
 	// fix deps.json
 	if !isNetFx {
 		checkedDependencies := []depsFileDetail{}
@@ -135,6 +210,9 @@ func main() {
 				}
 			}
 
+			// 先修改所有deps.json得出需要移动的依赖，冲突检查完成后再移动
+			fixedDependencies := make([]*fixedDeps, 0, len(checkedDependencies))
+
 			for _, deps := range checkedDependencies {
 				isHidden, hidErr := misc.IsHiddenFile(deps.deps)
 
@@ -142,6 +220,8 @@ func main() {
 					misc.ShowFile(deps.deps)
 				}
 
+				original, _ := ioutil.ReadFile(deps.deps)
+
 				log.LogDetail(fmt.Sprintf("fixing %s", deps.deps))
 
 				SCDMode := deps.fxrVersion != "" && deps.rid != ""
@@ -176,9 +256,44 @@ func main() {
 
 				usePatch = SCDMode && usePatch
 
-				allDeps, _useWPF, _ := manager.FixDeps(deps.deps, deps.main, SCDMode, noRuntimeInfo, usePatch, enableDebug, sharedRuntimeMode, startupHook)
+				allDeps, traits, loaderDeps, filtered := manager.FixDeps(deps.deps, deps.main, SCDMode, noRuntimeInfo, usePatch, enableDebug, sharedRuntimeMode, startupHook)
 
-				useWPF = _useWPF
+				appTraits[deps.main] = traits
+				appLoaderDeps[deps.main] = loaderDeps
+
+				fixedDependencies = append(fixedDependencies, &fixedDeps{
+					depsFileDetail: deps,
+					original:       original,
+					allDeps:        allDeps,
+					filtered:       filtered,
+					usePatch:       usePatch,
+					success:        success,
+					hidden:         isHidden && hidErr == nil,
+				})
+			}
+
+			// SRM模式下文件按hash存放，不会冲突
+			if !sharedRuntimeMode {
+				plans := make([]depsPlan, 0, len(fixedDependencies))
+				for _, deps := range fixedDependencies {
+					plans = append(plans, depsPlan{baseDir: beautyDir, libsDir: libsDir, deps: deps.allDeps})
+				}
+
+				checkConflicts(plans, func() {
+					for _, deps := range fixedDependencies {
+						if deps.original != nil {
+							ioutil.WriteFile(deps.deps, deps.original, 0666)
+						}
+						if deps.hidden {
+							misc.HideFile(deps.deps)
+						}
+					}
+					log.LogDetail("deps.json restored")
+				})
+			}
+
+			for _, deps := range fixedDependencies {
+				usePatch = deps.usePatch
 
 				if sharedRuntimeMode {
 					log.LogDetail("Shared Runtime Mode: Yes")
@@ -187,20 +302,30 @@ func main() {
 					log.LogDetail("Shared Runtime Mode: No")
 				}
 
-				_, _, curSubDirs, _srmMapping := moveDeps(allDeps, deps.main, sharedRuntimeMode)
+				manager.RemoveSatellites(filepath.Dir(deps.deps), deps.filtered)
+
+				_, _, curSubDirs, _srmMapping, relocated := moveDeps(deps.allDeps, deps.main, sharedRuntimeMode)
 
-				srmMapping = _srmMapping
+				srmMapping[deps.main] = _srmMapping
 				subDirs = append(subDirs, curSubDirs...)
 
-				if success {
+				if !manager.FixRuntimeTargets(deps.deps, relocated) {
+					deps.success = false
+				}
+
+				if deps.success {
 					log.LogDetail(fmt.Sprintf("%s fixed", deps.deps))
 				}
 
-				if isHidden && hidErr == nil {
+				if deps.hidden {
 					misc.HideFile(deps.deps)
 				}
 			}
 
+			if sharedRuntimeMode {
+				dedupeSRMNative(filepath.Join(beautyDir, libsDir, "srm_native"))
+			}
+
 			// patch
 			if usePatch && fxrVersion != "" && rid != "" {
 				patch(fxrVersion, rid)
@@ -211,32 +336,7 @@ func main() {
 			os.Exit(0)
 		}
 	} else {
-		for _, appConfig := range exeConfig {
-			isHidden, hidErr := misc.IsHiddenFile(appConfig)
-
-			if isHidden && hidErr == nil {
-				misc.ShowFile(appConfig)
-			}
-
-			appConfig = strings.ReplaceAll(appConfig, "\\", "/")
-			main := strings.Replace(filepath.Base(appConfig), ".exe.config", "", -1)
-
-			log.LogDetail(fmt.Sprintf("fixing %s", appConfig))
-
-			log.LogDetail(".Net Fx: Yes")
-
-			allDeps, success := manager.FixExeConfig(appConfig, libsDir)
-
-			moveDeps(allDeps, main, false)
-
-			if success {
-				log.LogDetail(fmt.Sprintf("%s fixed", appConfig))
-			}
-
-			if isHidden && hidErr == nil {
-				misc.HideFile(appConfig)
-			}
-		}
+		fixExeConfigs(exeConfig)
 	}
 
 	uniqieSubDirs := []string{}
@@ -267,7 +367,7 @@ func main() {
 				}
 			}
 
-			if appHostEntry != "" {
+			if appHostEntry != "" || appHostSubsystem != "" {
 				for _, runtimeConfig := range runtimeConfigs {
 					fullPath := strings.ReplaceAll(runtimeConfig, "\\", "/")
 					fileName := filepath.Base(fullPath)
@@ -314,7 +414,7 @@ func main() {
 					misc.ShowFile(runtimeConfig)
 				}
 
-				if appHostEntry != "" {
+				if appHostEntry != "" || appHostSubsystem != "" {
 					fullPath := strings.ReplaceAll(runtimeConfig, "\\", "/")
 					fileName := filepath.Base(fullPath)
 					main := strings.SplitN(fileName, ".runtimeconfig", 2)[0]
@@ -335,18 +435,38 @@ func main() {
 								log.LogDetail("IsBundle: No")
 							}
 
-							log.LogDetail("Original Entry: " + _apphost.AppHost.Entry)
+							if _apphost.AppHost.Subsystem != "" {
+								log.LogDetail("Subsystem: " + _apphost.AppHost.Subsystem)
+							}
+
+							if appHostEntry != "" {
+								log.LogDetail("Original Entry: " + _apphost.AppHost.Entry)
+							}
 
-							log.LogDetail("Patched Entry: " + appHostEntry)
+							entryPatched, subsystemPatched := manager.PatchAppHost(_apphost.AppHost, manager.AppHostPatch{
+								Entry:     appHostEntry,
+								Subsystem: appHostSubsystem,
+							})
 
-							_apphost.IsPatched = true
+							_apphost.IsPatched = entryPatched || subsystemPatched
 
-							success := manager.PatchAppHost(_apphost.AppHost, appHostEntry)
+							if subsystemPatched {
+								_apphost.AppHost.Subsystem = appHostSubsystem
+								log.LogDetail("Patched Subsystem: " + appHostSubsystem)
+							}
+
+							if entryPatched {
+								log.LogDetail("Patched Entry: " + appHostEntry)
+							}
 
-							if success {
+							if _apphost.IsPatched {
 								log.LogDetail(fmt.Sprintf("%s patched", _apphost.AppHost.Location))
 							}
 
+							if appHostEntry == "" {
+								continue
+							}
+
 							if appHostDir != "" {
 								newLocation := filepath.Join(appHostDir, _apphost.AppHost.Name)
 								newPath := filepath.Dir(newLocation)
@@ -355,7 +475,8 @@ func main() {
 									log.LogError(fmt.Errorf("%s is not writeable", newPath), false)
 								}
 
-								if err := os.Rename(_apphost.AppHost.Location, newLocation); err == nil {
+								// 入口已按appHostDir修改，留在原位置的副本或链接会指向错误的入口，因此总是移动
+								if _, err := misc.PlaceFile(_apphost.AppHost.Location, newLocation, misc.MoveMode); err == nil {
 									log.LogDetail(fmt.Sprintf("AppHost: %s, moved to: %s", _apphost.AppHost.Name, newLocation))
 								} else {
 									fmt.Println(err.Error())
@@ -367,16 +488,50 @@ func main() {
 
 				log.LogDetail(fmt.Sprintf("fixing %s", runtimeConfig))
 
-				success := manager.AddStartUpHookToRuntimeConfig(runtimeConfig, startupHook) && manager.FixRuntimeConfig(runtimeConfig, libsDir, uniqieSubDirs, srmMapping, sharedRuntimeMode, usePatch, useWPF, rollForward)
+				main := strings.SplitN(filepath.Base(strings.ReplaceAll(runtimeConfig, "\\", "/")), ".runtimeconfig", 2)[0]
+
+				success := manager.AddStartUpHookToRuntimeConfig(runtimeConfig, startupHook) && manager.FixRuntimeConfig(runtimeConfig, libsDir, appLibsDirs[main], uniqieSubDirs, srmMapping[main], sharedRuntimeMode, usePatch, appTraits[main], appLoaderDeps[main], rollForward)
 
 				if success {
 					log.LogDetail(fmt.Sprintf("%s fixed", runtimeConfig))
 				}
 
+				if sharedRuntimeMode && usePatch && !manager.VerifySatelliteProbing(runtimeConfig) {
+					log.LogError(fmt.Errorf("%s: some satellite assemblies can not be found by the host, their resources will fall back to the neutral culture", runtimeConfig), false)
+				}
+
 				if isHidden && hidErr == nil {
 					misc.HideFile(runtimeConfig)
 				}
 			}
+
+			// IIS通过web.config中的processPath/arguments启动应用，需要与移动后的apphost及入口保持一致
+			webConfig := filepath.Join(beautyDir, "web.config")
+			if appHostEntry != "" && util.PathExists(webConfig) {
+				for _, runtimeConfig := range runtimeConfigs {
+					main := strings.SplitN(filepath.Base(strings.ReplaceAll(runtimeConfig, "\\", "/")), ".runtimeconfig", 2)[0]
+
+					hostDir := beautyDir
+					if appHostDir != "" {
+						hostDir = appHostDir
+					}
+
+					appHost := ""
+					for _, _apphost := range apphosts[main] {
+						if _apphost.AppHost.IsBundle {
+							continue
+						}
+						appHost = filepath.Join(hostDir, _apphost.AppHost.Name)
+						break
+					}
+
+					if manager.FixWebConfig(webConfig, main, appHost, filepath.Join(hostDir, appHostEntry)) {
+						log.LogDetail(fmt.Sprintf("%s fixed", webConfig))
+					}
+				}
+
+				manager.VerifyWebConfig(webConfig)
+			}
 		} else {
 			log.LogDetail(fmt.Sprintf("no runtimeconfig.json found in %s", beautyDir))
 			log.LogDetail("skipping")
@@ -396,12 +551,38 @@ func main() {
 		}
 	}
 
+	if !isNetFx {
+		handleOrphans()
+	}
+
+	if symbolsOut != "" {
+		collectSymbols()
+	}
+
 	// hide files
 	hideFiles()
 
 	log.LogDetail("nbeauty done. Enjoy it!")
 }
 
+// validateJSONFiles 校验所有deps.json及runtimeconfig.json，输出所有不符合预期的节点
+func validateJSONFiles(dependencies []string, runtimeConfigs []string) bool {
+	diagnostics := make([]manager.JSONDiagnostic, 0)
+
+	for _, deps := range dependencies {
+		diagnostics = append(diagnostics, manager.ValidateDepsJSON(deps)...)
+	}
+	for _, runtimeConfig := range runtimeConfigs {
+		diagnostics = append(diagnostics, manager.ValidateRuntimeConfigJSON(runtimeConfig)...)
+	}
+
+	for _, diagnostic := range diagnostics {
+		log.LogError(errors.New(diagnostic.String()), false)
+	}
+
+	return len(diagnostics) == 0
+}
+
 func initCLI() {
 	flag.CommandLine = flag.NewFlagSet("nbeauty", flag.ContinueOnError)
 	flag.CommandLine.Usage = usage
@@ -428,6 +609,43 @@ Info: Log everything.
 `)
 	flag.StringVar(&appHostEntry, "apphostentry", "", `[.NET Core Non Single-File App Only] patch apphost entry location.`)
 	flag.StringVar(&appHostDir, "apphostdir", "", `[.NET Core Non Single-File App Only] relative path based on beautyDir.`)
+	flag.StringVar(&fxConfigs, "fxconfigs", "", `[.NET Framework App Only] additional config files relative to beautyDir, each may specify its own libsDir (relative to the config file).
+*.dll.config files are only processed when listed here, a file referenced by several configs in the same directory belongs to one of them and the others probe its libsDir.
+e.g. "Launcher.config;plugins/MyAddIn.dll.config=libs"
+`)
+	flag.StringVar(&rulesFile, "rules", "", `[.NET Core App Only] additional rule file (JSON) extending the built-in rules of files that must stay in root.
+see "Custom Keep Rules" in README.md for the format.
+`)
+	flag.StringVar(&cultures, "cultures", "", `satellite assembly cultures to keep, multi-cultures separated with ";", parent and child cultures are kept as well. Example: en;zh-Hans
+others will be removed, including their deps.json resources entries.
+`)
+	flag.StringVar(&sidecars, "sidecars", defaultSidecars, `files moved together with their owner, multi-templates separated with ";", templates ending with "/" are directories.
+{name} is the owner file name, {base} is the owner file name without extension.
+templates may contain wildcards (*, ?, [...]) matched within the owner's directory, e.g. {base}.*.xml
+`)
+	flag.StringVar(&symbolsOut, "symbols-out", "", `collect all PDB and native debug files (.dbg/.dSYM) into a directory or a .zip file in symbol server (SSQP) layout, and remove them from beautyDir.
+an index file (index.txt) maps each symbol key to its original path.
+`)
+	flag.StringVar(&orphansPolicy, "orphans", "report", `[.NET Core App Only] how to handle dlls and natives in beautyDir that are not referenced by any deps.json, runtimeconfig.json, web.config or rule. valid values: report/quarantine
+report: log them with their sizes.
+quarantine: move them into beautyDir/orphans, where they will never be loaded.
+orphans can not be moved into libsDir: they are not listed in any deps.json, so DllImport and Assembly.LoadFrom would no longer find them.
+`)
+	flag.StringVar(&conflictPolicy, "conflict", "error", `how to handle apps that place different files at the same location of a shared libsDir in one run. files left in libsDir by a previous run are always replaced. valid values: error/highest/perapp
+error: report the conflicts of all apps and stop before moving anything. older versions overwrote the file with the last app instead.
+highest: keep the higher assembly version, then the higher file version. files whose versions are equal or unknown stay in beautyDir.
+perapp: move the conflicting file into libsDir/<app>, which is probed before libsDir by that app only.
+`)
+	flag.StringVar(&linkMode, "link-mode", misc.MoveMode, `how to place files into libsDir. valid values: move/copy/hardlink/symlink/reflink
+move: move files, falls back to copy+delete across devices.
+copy/hardlink/reflink: keep the original layout, hardlink and reflink fall back to copy when unsupported.
+symlink: move files and leave symbolic links at the old locations.
+the mode applies to dependencies, sidecars and architecture folders. apphosts moved by --apphostdir and quarantined orphans are always moved.
+`)
+	flag.StringVar(&outDir, "out", "", `write the beautified app into a new (or empty) directory and leave beautyDir untouched.
+a relative libsDir is resolved against the output directory.
+`)
+	flag.StringVar(&appHostSubsystem, "apphost-subsystem", "", `[.NET Core Windows App Only] switch apphost subsystem. valid values: console/gui`)
 
 	flag.Parse()
 
@@ -488,6 +706,18 @@ Info: Log everything.
 			fmt.Printf("current default git cdn has been deleted, it was: [%s] before\n", cdn)
 		}
 		exit()
+	case "pack":
+		checkArgumentsCount(3, argv)
+		packDir(strings.Trim(args[1], `"`), strings.Trim(args[2], `"`))
+		exit()
+	case "delta":
+		checkArgumentsCount(4, argv)
+		createDelta(strings.Trim(args[1], `"`), strings.Trim(args[2], `"`), strings.Trim(args[3], `"`))
+		exit()
+	case "apply":
+		checkArgumentsCount(3, argv)
+		applyDelta(strings.Trim(args[1], `"`), strings.Trim(args[2], `"`))
+		exit()
 	default:
 		if gitcdn == "" {
 			cdn := manager.GetCDN()
@@ -518,20 +748,369 @@ Info: Log everything.
 		}
 		beautyDir = absDir
 
+		// 使用--out时，相对于beautyDir的参数按输出目录解析，所有参数校验通过后才复制
+		workDir := beautyDir
+
+		outDir = strings.Trim(outDir, `"`)
+		if outDir != "" {
+			outDir, err = filepath.Abs(outDir)
+			if err != nil {
+				log.LogPanic(fmt.Errorf("invalid out: %s", err.Error()), 1)
+			}
+			if !isSeparateDir(beautyDir, outDir) {
+				log.LogPanic(fmt.Errorf("out can not overlap beautyDir: %s", outDir), 1)
+			}
+			if files, _ := ioutil.ReadDir(outDir); len(files) != 0 {
+				log.LogPanic(fmt.Errorf("out is not empty: %s", outDir), 1)
+			}
+			workDir = outDir
+		}
+
 		loaderVerPolicy = strings.TrimSpace(loaderVerPolicy)
 		loaderVerPolicy = strings.ToLower(loaderVerPolicy)
 
 		appHostEntry = strings.Trim(appHostEntry, `"`)
 		strings.ReplaceAll(appHostEntry, "\\", "/")
 
+		appHostSubsystem = strings.ToLower(strings.TrimSpace(strings.Trim(appHostSubsystem, `"`)))
+		if appHostSubsystem != "" && appHostSubsystem != "console" && appHostSubsystem != "gui" {
+			log.LogPanic(fmt.Errorf("invalid apphost subsystem: %s", appHostSubsystem), 1)
+		}
+
+		fxConfigs = strings.Trim(fxConfigs, `"`)
+		for _, fxConfig := range strings.Split(fxConfigs, ";") {
+			fxConfig = strings.TrimSpace(fxConfig)
+			if fxConfig == "" {
+				continue
+			}
+
+			configLibsDir := ""
+			if i := strings.Index(fxConfig, "="); i != -1 {
+				fxConfig, configLibsDir = strings.TrimSpace(fxConfig[:i]), strings.TrimSpace(fxConfig[i+1:])
+			}
+
+			if !util.PathExists(filepath.Join(beautyDir, fxConfig)) {
+				log.LogPanic(fmt.Errorf("config file not found: %s", fxConfig), 1)
+			}
+
+			absConfig, _ := filepath.Abs(filepath.Join(workDir, fxConfig))
+			fxConfigLibsDirs[absConfig] = configLibsDir
+		}
+
+		sidecars = strings.Trim(sidecars, `"`)
+
+		conflictPolicy = strings.ToLower(strings.TrimSpace(strings.Trim(conflictPolicy, `"`)))
+		if conflictPolicy != "error" && conflictPolicy != "highest" && conflictPolicy != "perapp" {
+			log.LogPanic(fmt.Errorf("invalid conflict policy: %s", conflictPolicy), 1)
+		}
+
+		linkMode = strings.ToLower(strings.TrimSpace(strings.Trim(linkMode, `"`)))
+		validLinkMode := false
+		for _, mode := range misc.LinkModes {
+			validLinkMode = validLinkMode || mode == linkMode
+		}
+		if !validLinkMode {
+			log.LogPanic(fmt.Errorf("invalid link mode: %s", linkMode), 1)
+		}
+
+		orphansPolicy = strings.ToLower(strings.TrimSpace(strings.Trim(orphansPolicy, `"`)))
+		if orphansPolicy != "report" && orphansPolicy != "quarantine" {
+			log.LogPanic(fmt.Errorf("invalid orphans policy: %s", orphansPolicy), 1)
+		}
+
+		symbolsOut = strings.Trim(symbolsOut, `"`)
+		if symbolsOut != "" {
+			symbolsOut, err = filepath.Abs(symbolsOut)
+			if err != nil {
+				log.LogPanic(fmt.Errorf("invalid symbols out: %s", err.Error()), 1)
+			}
+			for _, dir := range []string{beautyDir, workDir} {
+				if rel, err := filepath.Rel(dir, symbolsOut); err == nil && !strings.HasPrefix(rel, "..") {
+					log.LogPanic(fmt.Errorf("symbols out can not be inside %s: %s", dir, symbolsOut), 1)
+				}
+			}
+		}
+
+		manager.Cultures = manager.ParseCultures(strings.Trim(cultures, `"`))
+
+		rulesFile = strings.Trim(rulesFile, `"`)
+		if rulesFile != "" {
+			if err := manager.LoadKeepRules(rulesFile); err != nil {
+				log.LogPanic(fmt.Errorf("invalid rule file: %s", err.Error()), 1)
+			}
+		}
+
 		appHostDir = strings.Trim(appHostDir, `"`)
 		if appHostDir != "" {
-			appHostDir, err = filepath.Abs(filepath.Join(beautyDir, appHostDir))
+			appHostDir, err = filepath.Abs(filepath.Join(workDir, appHostDir))
 			if err != nil {
 				log.LogPanic(fmt.Errorf("invalid appHostDir: %s", err.Error()), 1)
 			}
 		}
+
+		if outDir != "" {
+			copyToOut(beautyDir, outDir)
+			beautyDir = outDir
+		}
+	}
+}
+
+// copyToOut 将beautyDir复制到out，保留符号链接，失败时删除已复制的内容
+func copyToOut(dir string, out string) {
+	// 与main中的校验相同，格式错误时不留下未处理的副本
+	isFx := len(manager.FindExeConfig(dir)) != 0 || len(fxConfigLibsDirs) != 0
+	if !isFx && !validateJSONFiles(manager.FindDepsJSON(dir), manager.FindRuntimeConfigJSON(dir)) {
+		log.LogError(errors.New("malformed deps.json or runtimeconfig.json, nothing has been changed"), true)
+	}
+
+	existed := util.PathExists(out)
+
+	if _, err := misc.PlaceFile(dir, out, misc.CopyMode); err != nil {
+		if existed {
+			files, _ := ioutil.ReadDir(out)
+			for _, file := range files {
+				os.RemoveAll(filepath.Join(out, file.Name()))
+			}
+		} else {
+			os.RemoveAll(out)
+		}
+		log.LogPanic(fmt.Errorf("copy beautyDir to out failed: %s", err.Error()), 1)
 	}
+
+	log.LogDetail(fmt.Sprintf("copied %s => %s", dir, out))
+}
+
+// handleOrphans 按orphansPolicy处理根目录中的孤立文件
+func handleOrphans() {
+	excludeFiles := strings.Split(excludes, ";")
+	hiddenFiles := strings.Split(hiddens, ";")
+
+	// 以move以外的方式放置时原文件留在原位置，其deps.json条目可能已被删除（SCD、--noruntimeinfo），不是孤立文件
+	placedSources := make(map[string]bool)
+	for _, source := range placedFiles {
+		placedSources[source] = true
+	}
+
+	var total int64
+
+	for _, orphan := range manager.FindOrphans(beautyDir, startupHook) {
+		if fileMatch(orphan.Name, excludeFiles) || fileMatch(orphan.Name, hiddenFiles) {
+			continue
+		}
+
+		if source, _ := filepath.Abs(filepath.Join(beautyDir, orphan.Name)); placedSources[source] {
+			continue
+		}
+
+		total += orphan.Size
+
+		switch orphansPolicy {
+		case "quarantine":
+			target := filepath.Join(beautyDir, orphansDir)
+
+			if err := manager.MoveOrphan(beautyDir, orphan, target); err != nil {
+				log.LogError(fmt.Errorf("move orphan failed: %s : %s", orphan.Name, err.Error()), false)
+				continue
+			}
+
+			rel, _ := filepath.Rel(beautyDir, filepath.Join(target, orphan.Name))
+			log.LogDetail(fmt.Sprintf("orphan: %s (%d bytes) => %s", orphan.Name, orphan.Size, filepath.ToSlash(rel)))
+		default:
+			log.LogDetail(fmt.Sprintf("orphan: %s (%d bytes)", orphan.Name, orphan.Size))
+		}
+	}
+
+	if total > 0 {
+		log.LogDetail(fmt.Sprintf("orphans total: %d bytes", total))
+	}
+}
+
+// collectSymbols 将所有符号文件按SSQP结构收集到symbolsOut中，并从beautyDir中删除
+func collectSymbols() {
+	log.LogDetail(fmt.Sprintf("collecting symbols to %s", symbolsOut))
+
+	collected, err := symbols.Collect(beautyDir)
+	if err != nil {
+		log.LogError(fmt.Errorf("collect symbols failed: %s", err.Error()), false)
+		return
+	}
+
+	for _, symbol := range collected {
+		if symbol.Key == "" {
+			log.LogError(fmt.Errorf("symbol key can not be determined, stored as unindexed: %s", symbol.Source), false)
+		} else {
+			log.LogDetail(fmt.Sprintf("symbol: %s => %s", symbol.Source, symbol.Key))
+		}
+	}
+
+	modTime, err := pack.ModTime()
+	if err != nil {
+		log.LogPanic(err, 1)
+	}
+
+	if err := symbols.Write(beautyDir, collected, symbolsOut, modTime); err != nil {
+		log.LogError(fmt.Errorf("write symbols failed: %s : %s", symbolsOut, err.Error()), false)
+		return
+	}
+
+	symbols.Remove(beautyDir, collected)
+
+	log.LogDetail(fmt.Sprintf("%d symbols collected", len(collected)))
+}
+
+// fxConfig 一个.NET Framework配置文件及其拥有的依赖
+type fxConfig struct {
+	config  string
+	dir     string
+	libsDir string
+	main    string
+	deps    []manager.Deps
+	// filtered 被--cultures过滤的卫星程序集，冲突检查通过后才删除
+	filtered []manager.Deps
+	success  bool
+	// sharedLibsDirs 其它配置的libsDir，存放了本配置也引用的程序集
+	sharedLibsDirs []string
+}
+
+// fixExeConfigs 移动所有配置文件的依赖并修改配置文件
+// 同一目录下的多个配置引用同一文件时，文件只属于一个配置，其它配置额外探测该配置的libsDir
+func fixExeConfigs(exeConfig []string) {
+	// 每个配置文件对应的宿主（exe或dll）都不能被移动
+	hosts := make(map[string]bool)
+	for _, appConfig := range exeConfig {
+		host, _ := filepath.Abs(strings.TrimSuffix(appConfig, ".config"))
+		hosts[host] = true
+	}
+
+	configs := make([]*fxConfig, 0, len(exeConfig))
+
+	// 移动前先分析所有配置，决定每个文件的归属
+	owners := make(map[string]*fxConfig)
+	bound := make(map[*fxConfig]map[string]bool)
+	claims := make(map[*fxConfig][]string)
+
+	for _, appConfig := range exeConfig {
+		absConfig, _ := filepath.Abs(appConfig)
+
+		config := &fxConfig{
+			config:  strings.ReplaceAll(appConfig, "\\", "/"),
+			dir:     filepath.Dir(absConfig),
+			libsDir: libsDir,
+		}
+		if dir := fxConfigLibsDirs[absConfig]; dir != "" {
+			config.libsDir = dir
+		}
+
+		config.main = strings.TrimSuffix(filepath.Base(config.config), ".config")
+		config.main = strings.TrimSuffix(strings.TrimSuffix(config.main, ".exe"), ".dll")
+
+		allDeps, filtered, success := manager.AnalyzeExeConfig(appConfig)
+		config.filtered = filtered
+		config.success = success
+
+		for _, dep := range allDeps {
+			absDep, _ := filepath.Abs(filepath.Join(config.dir, dep.Path))
+			if hosts[absDep] {
+				log.LogDetail(fmt.Sprintf("%s is a config host, keep it in place", dep.Path))
+				continue
+			}
+			config.deps = append(config.deps, dep)
+			claims[config] = append(claims[config], absDep)
+		}
+
+		bound[config] = manager.BoundAssemblies(appConfig)
+		configs = append(configs, config)
+	}
+
+	// assemblyBinding中显式声明的优先，其次按配置的顺序
+	for _, explicit := range []bool{true, false} {
+		for _, config := range configs {
+			for i, dep := range config.deps {
+				absDep := claims[config][i]
+				if _, ok := owners[absDep]; !ok && (!explicit || bound[config][dep.Name]) {
+					owners[absDep] = config
+				}
+			}
+		}
+	}
+
+	owned := make(map[*fxConfig][]manager.Deps)
+	plans := make([]depsPlan, 0, len(configs))
+
+	for _, config := range configs {
+		for i, dep := range config.deps {
+			owner := owners[claims[config][i]]
+			if owner == config {
+				owned[config] = append(owned[config], dep)
+				continue
+			}
+
+			log.LogDetail(fmt.Sprintf("%s belongs to %s", dep.Path, owner.config))
+
+			sharedLibsDir, _ := filepath.Rel(config.dir, filepath.Join(owner.dir, owner.libsDir))
+			config.sharedLibsDirs = appendUnique(config.sharedLibsDirs, filepath.ToSlash(sharedLibsDir))
+		}
+
+		plans = append(plans, depsPlan{baseDir: config.dir, libsDir: config.libsDir, deps: owned[config]})
+	}
+
+	// 配置文件在所有文件移动完成后才修改，此时无需恢复
+	checkConflicts(plans, nil)
+
+	relocated := make(map[string]map[string]string)
+
+	for _, config := range configs {
+		log.LogDetail(fmt.Sprintf("moving dependencies of %s", config.config))
+
+		manager.RemoveSatellites(config.dir, config.filtered)
+
+		_, _, _, _, configRelocated := moveDepsTo(config.dir, config.libsDir, owned[config], config.main, false)
+
+		moveNativeArchDirs(config.dir, config.libsDir, configRelocated)
+
+		if _, ok := relocated[config.dir]; !ok {
+			relocated[config.dir] = make(map[string]string)
+		}
+		for oldPath, newPath := range configRelocated {
+			relocated[config.dir][oldPath] = newPath
+		}
+	}
+
+	// 所有文件移动完成后再修改配置，codeBase可能指向其它配置移动的文件
+	for _, config := range configs {
+		isHidden, hidErr := misc.IsHiddenFile(config.config)
+
+		if isHidden && hidErr == nil {
+			misc.ShowFile(config.config)
+		}
+
+		log.LogDetail(fmt.Sprintf("fixing %s", config.config))
+
+		log.LogDetail(".Net Fx: Yes")
+
+		if config.libsDir != libsDir {
+			log.LogDetail(fmt.Sprintf("Libs Dir: %s", config.libsDir))
+		}
+
+		success := config.success && manager.FixExeConfig(config.config, config.libsDir, appLibsDirs[config.main], config.sharedLibsDirs, relocated[config.dir])
+
+		if success {
+			log.LogDetail(fmt.Sprintf("%s fixed", config.config))
+		}
+
+		if isHidden && hidErr == nil {
+			misc.HideFile(config.config)
+		}
+	}
+}
+
+func appendUnique(arr []string, v string) []string {
+	for _, c := range arr {
+		if c == v {
+			return arr
+		}
+	}
+	return append(arr, v)
 }
 
 func checkArgumentsCount(excepted int, got int) bool {
@@ -546,9 +1125,22 @@ func exit() {
 	os.Exit(0)
 }
 
+// isSeparateDir 两个目录互不包含
+func isSeparateDir(a string, b string) bool {
+	for _, pair := range [][2]string{{a, b}, {b, a}} {
+		if rel, err := filepath.Rel(pair[0], pair[1]); err == nil && !strings.HasPrefix(rel, "..") {
+			return false
+		}
+	}
+	return true
+}
+
 func usage() {
 	fmt.Println("Usage:")
-	fmt.Println("nbeauty [--loglevel=(Error|Detail|Info)] [--srmode] [--enabledebug] [--usepatch] [--hiddens=hiddenFiles] [--noruntimeinfo] [--roll-forward=<rollForward>] [--nbloaderverpolicy=(auto|with|without)] [--apphostentry=<appHostEntry>] [--apphostdir=<appHostDir>] <beautyDir> [<libsDir> [<excludes>]]")
+	fmt.Println("nbeauty [--loglevel=(Error|Detail|Info)] [--srmode] [--enabledebug] [--usepatch] [--hiddens=hiddenFiles] [--noruntimeinfo] [--roll-forward=<rollForward>] [--nbloaderverpolicy=(auto|with|without)] [--apphostentry=<appHostEntry>] [--apphostdir=<appHostDir>] [--apphost-subsystem=(console|gui)] [--fxconfigs=<configFiles>] [--rules=<ruleFile>] [--cultures=<cultures>] [--sidecars=<templates>] [--symbols-out=<dir|zip>] [--orphans=(report|quarantine)] [--conflict=(error|highest|perapp)] [--link-mode=(move|copy|hardlink|symlink|reflink)] [--out=<dir>] <beautyDir> [<libsDir> [<excludes>]]")
+	fmt.Println("nbeauty [--loglevel=(Error|Detail|Info)] [--hiddens=hiddenFiles] pack <dir> <out.zip|out.tar.gz>")
+	fmt.Println("nbeauty [--loglevel=(Error|Detail|Info)] delta <oldDir> <newDir> <out>")
+	fmt.Println("nbeauty [--loglevel=(Error|Detail|Info)] apply <deltaDir> <dir>")
 	fmt.Println("")
 	fmt.Println("Arguments")
 	fmt.Println("  <excludes>    dlls that no need to be moved, multi-dlls separated with \";\". Example: dll1.dll;lib*;...")
@@ -670,7 +1262,155 @@ func fileMatch(file string, sources []string) bool {
 	return match
 }
 
-func moveDeps(deps []manager.Deps, entry string, sharedRuntimeMode bool) (int, int, []string, map[string]string) {
+// sidecarFiles 根据sidecar模板得出随文件一起移动的附属文件的glob，以/结尾的为目录
+// {name}为完整文件名，{base}为不含扩展名的文件名，两者中的通配符会被转义
+func sidecarFiles(fileName string) []string {
+	base := fileName[:len(fileName)-len(filepath.Ext(fileName))]
+	replacer := strings.NewReplacer("{name}", globEscape(fileName), "{base}", globEscape(base))
+
+	files := make([]string, 0)
+	for _, template := range strings.Split(sidecars, ";") {
+		template = strings.TrimSpace(template)
+		if template == "" {
+			continue
+		}
+
+		files = append(files, replacer.Replace(template))
+	}
+
+	return files
+}
+
+// globEscape 转义filepath.Match中的通配符，Windows上不支持\转义，统一使用[]
+func globEscape(name string) string {
+	return strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]").Replace(name)
+}
+
+// dedupeSRMNative 所有应用移动完成后，srm_native中内容相同的native只保留一份，其余使用硬链接，包括之前运行留下的文件
+// 不支持硬链接的文件系统上保留副本
+// loader只在srm_native/<appID>中查找native，native之间的依赖也由系统在同一目录中查找，因此不能合并到一个共享目录
+func dedupeSRMNative(srmNativeDir string) {
+	// md5 => 第一个文件
+	index := make(map[string]string)
+
+	var saved int64
+
+	for _, file := range util.GetAllFiles(srmNativeDir, true) {
+		fileInfo, err := os.Lstat(file)
+		if err != nil || !fileInfo.Mode().IsRegular() || fileInfo.Size() == 0 {
+			continue
+		}
+
+		md5, err := util.GetFileMD5(file)
+		if err != nil {
+			continue
+		}
+
+		existing, ok := index[md5]
+		if !ok {
+			index[md5] = file
+			continue
+		}
+
+		if existingInfo, err := os.Stat(existing); err != nil || os.SameFile(existingInfo, fileInfo) {
+			continue
+		}
+
+		rel, _ := filepath.Rel(srmNativeDir, file)
+		existingRel, _ := filepath.Rel(srmNativeDir, existing)
+
+		// 先链接到临时文件再替换，失败时原文件不受影响
+		tmp := file + ".nblink"
+		if err := os.Link(existing, tmp); err != nil {
+			log.LogDetail(fmt.Sprintf("srm_native/%s can not be linked to %s, keep a copy: %s", filepath.ToSlash(rel), filepath.ToSlash(existingRel), err.Error()))
+			continue
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			os.Remove(tmp)
+			log.LogDetail(fmt.Sprintf("srm_native/%s can not be linked to %s, keep a copy: %s", filepath.ToSlash(rel), filepath.ToSlash(existingRel), err.Error()))
+			continue
+		}
+
+		saved += fileInfo.Size()
+		log.LogDetail(fmt.Sprintf("srm_native/%s => srm_native/%s (hardlink, %d bytes saved)", filepath.ToSlash(rel), filepath.ToSlash(existingRel), fileInfo.Size()))
+	}
+
+	if saved > 0 {
+		log.LogDetail(fmt.Sprintf("srm_native: %d bytes saved by hardlinks", saved))
+	}
+}
+
+// depsPlan 一个应用需要移动到baseDir/libsDir中的依赖
+type depsPlan struct {
+	baseDir string
+	libsDir string
+	deps    []manager.Deps
+}
+
+// findConflicts 在移动前找出多个应用移动到同一位置的不同文件，libsDir中已有的文件（上次运行的结果）不算冲突
+func findConflicts(plans []depsPlan) []*manager.FileConflict {
+	excludeFiles := strings.Split(excludes, ";")
+
+	conflicts := make([]*manager.FileConflict, 0)
+	// 目标 => 第一个移动到该位置的源文件
+	sources := make(map[string]string)
+
+	for _, plan := range plans {
+		for _, dep := range plan.deps {
+			if fileMatch(dep.Name, excludeFiles) {
+				continue
+			}
+
+			for _, filePath := range []string{dep.SecondPath, dep.Path} {
+				source, _ := filepath.Abs(filepath.Join(plan.baseDir, filePath))
+				if !util.PathExists(source) {
+					continue
+				}
+
+				usingPath := strings.ReplaceAll(filePath, "\\", "/")
+				if !isNetFx && dep.Type == manager.Resource {
+					usingPath = "locales/" + usingPath
+				}
+
+				target, _ := filepath.Abs(plan.baseDir + "/" + plan.libsDir + "/" + usingPath)
+
+				first, ok := sources[target]
+				if !ok {
+					sources[target] = source
+				} else if first != source {
+					if conflict := manager.DetectConflict(source, first); conflict != nil {
+						conflicts = append(conflicts, conflict)
+					}
+				}
+				break
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// checkConflicts 报告所有冲突，conflictPolicy为error时调用restore后退出
+func checkConflicts(plans []depsPlan, restore func()) {
+	conflicts := findConflicts(plans)
+	for _, conflict := range conflicts {
+		log.LogError(errors.New(conflict.String()), false)
+	}
+
+	if len(conflicts) != 0 && conflictPolicy == "error" {
+		if restore != nil {
+			restore()
+		}
+		log.LogError(fmt.Errorf("%d conflicts found, nothing has been moved", len(conflicts)), true)
+	}
+}
+
+func moveDeps(deps []manager.Deps, entry string, sharedRuntimeMode bool) (int, int, []string, map[string]string, map[string]string) {
+	return moveDepsTo(beautyDir, libsDir, deps, entry, sharedRuntimeMode)
+}
+
+// moveDepsTo 将baseDir下的依赖移动到baseDir/libsDir中
+func moveDepsTo(baseDir string, libsDir string, deps []manager.Deps, entry string, sharedRuntimeMode bool) (int, int, []string, map[string]string, map[string]string) {
 	var isContains = func(arr []string, v string) bool {
 		for _, c := range arr {
 			if c == v {
@@ -685,13 +1425,38 @@ func moveDeps(deps []manager.Deps, entry string, sharedRuntimeMode bool) (int, i
 
 	realCount, moved, subDirs, srmMapping := 0, 0, make([]string, 0), make(map[string]string, 0)
 
+	// 移动前后的相对路径
+	relocated := make(map[string]string, 0)
+
+	appDir := filepath.Base(strings.ReplaceAll(entry, "\\", "/"))
+
+	// 使用patch的host按additionalProbingPaths查找卫星程序集，应用的所有卫星程序集放在同一个locales/<slot>中
+	satelliteSlot := ""
+	if !isNetFx && sharedRuntimeMode && usePatch {
+		satellites := make(map[string]string)
+		for _, dep := range deps {
+			if dep.Type != manager.Resource || fileMatch(dep.Name, excludeFiles) {
+				continue
+			}
+			for _, filePath := range []string{dep.SecondPath, dep.Path} {
+				if source := filepath.Join(baseDir, filePath); util.PathExists(source) {
+					satellites[strings.ReplaceAll(filePath, "\\", "/")] = source
+					break
+				}
+			}
+		}
+		if len(satellites) != 0 {
+			satelliteSlot = manager.SatelliteSlot(filepath.Join(baseDir, libsDir, "locales"), satellites)
+		}
+	}
+
 	for _, dep := range deps {
 		var absDepsFile = ""
 		var usingPath = ""
 		var exist = false
 
 		for _, filePath := range []string{dep.SecondPath, dep.Path} {
-			absDepsFile = filepath.Join(beautyDir, filePath)
+			absDepsFile = filepath.Join(baseDir, filePath)
 			if util.PathExists(absDepsFile) {
 				usingPath = filePath
 				exist = true
@@ -736,23 +1501,31 @@ func moveDeps(deps []manager.Deps, entry string, sharedRuntimeMode bool) (int, i
 		fileName := parts[len(parts)-1]
 		subDir := strings.Join(parts[0:len(parts)-1], "/")
 
-		if dep.Type != manager.Resource && subDir != "" && !isContains(subDirs, subDir) {
+		// RID相关文件由host按deps.json中的路径加载，不能加入NetBeautyLibsDir，否则会加载到其它RID的文件
+		if dep.Type != manager.Resource && dep.Rid == "" && subDir != "" && !isContains(subDirs, subDir) {
 			subDirs = append(subDirs, subDir)
 		}
 
 		// native不能使用分层结构（多层依赖会导致加载不了dll）
+		// RID相关文件保持runtimes/<rid>/...结构，与native一样按应用隔离
 		if !isNetFx && sharedRuntimeMode {
-			if dep.Type != manager.Native {
+			if dep.Type != manager.Native && dep.Rid == "" {
 				md5, _ := util.GetFileMD5(absDepsFile)
 				if md5 == "" {
 					md5 = "generic"
 				}
-				parts = append(parts, md5, fileName)
-				srmKey := fileName
-				if dep.Type == manager.Resource {
-					srmKey = parts[0] + "/" + srmKey
+				if dep.Type == manager.Resource && satelliteSlot != "" {
+					// locales/<slot>/<culture>/<file>，host通过additionalProbingPaths按deps.json中的<culture>/<file>查找
+					parts = append([]string{satelliteSlot}, parts...)
+					srmMapping[usingPath2] = satelliteSlot
+				} else if dep.Type == manager.Resource {
+					// locales/<culture>/<file>/<md5>/<file>，由loader按映射查找
+					parts = append(parts, md5, fileName)
+					srmMapping[usingPath2] = md5
+				} else {
+					parts = append(parts, md5, fileName)
+					srmMapping[fileName] = md5
 				}
-				srmMapping[srmKey] = md5
 				usingPath = strings.Join(parts, "/")
 			} else {
 				appID, _ := util.GetStringMD5(entry)
@@ -766,38 +1539,205 @@ func moveDeps(deps []manager.Deps, entry string, sharedRuntimeMode bool) (int, i
 			usingPath = strings.Join(parts, "/")
 		}
 
-		newAbsDepsFile, _ := filepath.Abs(beautyDir + "/" + libsDir + "/" + usingPath)
+		newAbsDepsFile, _ := filepath.Abs(baseDir + "/" + libsDir + "/" + usingPath)
 		oldPath := filepath.Dir(absDepsFile)
+
+		if _, placed := placedFiles[newAbsDepsFile]; !placed && util.PathExists(newAbsDepsFile) {
+			log.LogDetail(fmt.Sprintf("%s: replaces the file left by a previous run", dep.Name))
+		} else if conflict := manager.DetectConflict(absDepsFile, newAbsDepsFile); conflict != nil && !sharedRuntimeMode {
+			result, comparable := conflict.Compare()
+
+			switch {
+			case conflictPolicy == "highest" && comparable && result > 0:
+				log.LogDetail(fmt.Sprintf("%s: source is higher and replaces the target, %s", dep.Name, conflict.String()))
+			case conflictPolicy == "highest" && comparable:
+				os.Remove(absDepsFile)
+				relocated[strings.ReplaceAll(usingPath2, "\\", "/")] = strings.TrimSuffix(strings.ReplaceAll(libsDir, "\\", "/"), "/") + "/" + usingPath
+				log.LogDetail(fmt.Sprintf("%s: target is higher, source removed, %s", dep.Name, conflict.String()))
+				util.RemoveEmptyDirs(baseDir, oldPath)
+				continue
+			case conflictPolicy == "perapp" && dep.Type != manager.Resource:
+				usingPath = appDir + "/" + usingPath
+				newAbsDepsFile, _ = filepath.Abs(baseDir + "/" + libsDir + "/" + usingPath)
+
+				appSubDir := appDir
+				if subDir != "" {
+					appSubDir += "/" + subDir
+				}
+				if !isContains(appLibsDirs[entry], appSubDir) {
+					appLibsDirs[entry] = append(appLibsDirs[entry], appSubDir)
+				}
+
+				log.LogDetail(fmt.Sprintf("%s: moved into %s for %s only", dep.Name, appSubDir, appDir))
+			default:
+				log.LogDetail(fmt.Sprintf("%s: can not be resolved, keep it in place", dep.Name))
+				continue
+			}
+		}
+
 		newPath := filepath.Dir(newAbsDepsFile)
 
 		if !util.EnsureDirExists(newPath, 0777) {
 			log.LogError(fmt.Errorf("%s is not writeable", newPath), false)
 		}
 
-		if err := os.Rename(absDepsFile, newAbsDepsFile); err == nil {
+		if used, err := misc.PlaceFile(absDepsFile, newAbsDepsFile, linkMode); err == nil {
+			placedFiles[newAbsDepsFile], _ = filepath.Abs(absDepsFile)
 			moved++
+			if used != linkMode {
+				log.LogDetail(fmt.Sprintf("%s: placed by %s instead of %s", dep.Name, used, linkMode))
+			}
+			relocated[strings.ReplaceAll(usingPath2, "\\", "/")] = strings.TrimSuffix(strings.ReplaceAll(libsDir, "\\", "/"), "/") + "/" + usingPath
 		} else {
 			fmt.Println(err.Error())
 		}
 
-		fileNameNoExt := fileName[:len(fileName)-len(filepath.Ext(fileName))]
+		for _, sidecar := range sidecarFiles(fileName) {
+			isDir := strings.HasSuffix(sidecar, "/")
+			sidecar = strings.TrimSuffix(sidecar, "/")
+
+			matches, _ := filepath.Glob(filepath.Join(oldPath, filepath.FromSlash(sidecar)))
+			for _, oldFile := range matches {
+				// 文件本身已经移动
+				if oldFile == absDepsFile {
+					continue
+				}
+
+				info, err := os.Stat(oldFile)
+				if err != nil || info.IsDir() != isDir {
+					continue
+				}
 
-		for _, extFile := range []string{".pdb", ".xml"} {
-			oldFile := filepath.Join(oldPath, fileNameNoExt+extFile)
-			newFile := filepath.Join(newPath, fileNameNoExt+extFile)
-			if util.PathExists(oldFile) {
-				os.Rename(oldFile, newFile)
+				rel, _ := filepath.Rel(oldPath, oldFile)
+				newFile := filepath.Join(newPath, rel)
+
+				if _, err := misc.PlaceFile(oldFile, newFile, linkMode); err == nil {
+					oldRel, _ := filepath.Rel(baseDir, oldFile)
+					newRel, _ := filepath.Rel(baseDir, newFile)
+					log.LogDetail(fmt.Sprintf("sidecar of %s: %s => %s", fileName, filepath.ToSlash(oldRel), filepath.ToSlash(newRel)))
+				} else {
+					log.LogError(fmt.Errorf("move sidecar failed: %s : %s", oldFile, err.Error()), false)
+				}
+			}
+		}
+
+		util.RemoveEmptyDirs(baseDir, oldPath)
+	}
+
+	return realCount, moved, subDirs, srmMapping, relocated
+}
+
+// moveNativeArchDirs 将已知包的架构目录（x86、x64等）移动到程序集所在的libsDir中
+func moveNativeArchDirs(baseDir string, libsDir string, relocated map[string]string) {
+	movedDirs := make(map[*manager.NativeArchRule][]string)
+	rules := make([]*manager.NativeArchRule, 0)
+
+	for _, archDir := range manager.NativeArchDirs {
+		absArchDir := filepath.Join(baseDir, archDir)
+		if !util.PathExists(absArchDir) {
+			continue
+		}
+
+		files, _ := util.ReadAllFile(absArchDir)
+
+		rule := manager.FindNativeArchRule(files)
+		if rule == nil {
+			log.LogDetail(fmt.Sprintf("%s/ is not used by any known package, keep it in place", archDir))
+			continue
+		}
+
+		if _, ok := relocated[rule.Assembly]; !ok {
+			log.LogDetail(fmt.Sprintf("%s/ is used by %s, but %s is not moved, keep it in place", archDir, rule.Package, rule.Assembly))
+			continue
+		}
+
+		newArchDir, _ := filepath.Abs(filepath.Join(baseDir, libsDir, archDir))
+		if util.PathExists(newArchDir) {
+			// 上次以symlink方式放置过
+			oldInfo, err1 := os.Stat(absArchDir)
+			newInfo, err2 := os.Stat(newArchDir)
+			if err1 != nil || err2 != nil || !os.SameFile(oldInfo, newInfo) {
+				log.LogError(fmt.Errorf("%s/ can not be moved, %s already exists", archDir, newArchDir), false)
+				continue
+			}
+		} else if _, err := misc.PlaceFile(absArchDir, newArchDir, linkMode); err != nil {
+			log.LogError(fmt.Errorf("move %s/ failed: %s", archDir, err.Error()), false)
+			continue
+		}
+
+		if _, ok := movedDirs[rule]; !ok {
+			rules = append(rules, rule)
+		}
+		movedDirs[rule] = append(movedDirs[rule], archDir+"/")
+	}
+
+	for _, rule := range rules {
+		log.LogDetail(fmt.Sprintf("%s uses architecture folders: %s => %s", rule.Package, strings.Join(movedDirs[rule], ", "), libsDir))
+
+		if rule.ConfigFile != "" && len(rule.Settings) != 0 {
+			config := filepath.Join(baseDir, filepath.Dir(relocated[rule.Assembly]), rule.ConfigFile)
+
+			// 包自带的配置文件需要跟随程序集
+			if oldConfig := filepath.Join(baseDir, rule.ConfigFile); util.PathExists(oldConfig) && !util.PathExists(config) {
+				misc.PlaceFile(oldConfig, config, linkMode)
 			}
+
+			manager.WriteAppSettings(config, rule.Settings)
+		}
+	}
+}
+
+// packDir 将目录打包为zip或tar.gz，根目录中匹配hiddens的文件及目录在zip中带有隐藏属性
+func packDir(dir string, out string) {
+	modTime, err := pack.ModTime()
+	if err != nil {
+		log.LogPanic(err, 1)
+	}
+
+	hiddensFiles := strings.Split(strings.Trim(hiddens, `"`), ";")
+	hidden := func(name string) bool {
+		if strings.Contains(name, "/") {
+			return false
+		}
+		if fileMatch(name, hiddensFiles) {
+			return true
 		}
+		isHidden, _ := misc.IsHiddenFile(filepath.Join(dir, name))
+		return isHidden
+	}
 
-		dir, _ := ioutil.ReadDir(oldPath)
+	if err := pack.Pack(dir, out, modTime, hidden); err != nil {
+		log.LogPanic(fmt.Errorf("pack failed: %s", err.Error()), 1)
+	}
+
+	log.LogDetail(fmt.Sprintf("packed %s => %s", dir, out))
+}
 
-		if len(dir) == 0 {
-			os.Remove(oldPath)
+// createDelta 生成从oldDir更新到newDir的增量包
+func createDelta(oldDir string, newDir string, out string) {
+	absOut, _ := filepath.Abs(out)
+	for _, dir := range []string{oldDir, newDir} {
+		if absDir, _ := filepath.Abs(dir); !isSeparateDir(absDir, absOut) {
+			log.LogPanic(fmt.Errorf("out can not overlap %s", dir), 1)
 		}
 	}
 
-	return realCount, moved, subDirs, srmMapping
+	manifest, err := delta.Create(oldDir, newDir, out)
+	if err != nil {
+		log.LogPanic(fmt.Errorf("create delta failed: %s", err.Error()), 1)
+	}
+
+	log.LogDetail(fmt.Sprintf("added: %d, changed: %d, removed: %d, unchanged SRM dirs skipped: %d", len(manifest.Added), len(manifest.Changed), len(manifest.Removed), len(manifest.Skipped)))
+}
+
+// applyDelta 将增量包应用到dir
+func applyDelta(pkg string, dir string) {
+	manifest, err := delta.Apply(pkg, dir)
+	if err != nil {
+		log.LogPanic(fmt.Errorf("apply delta failed: %s", err.Error()), 1)
+	}
+
+	log.LogDetail(fmt.Sprintf("added: %d, changed: %d, removed: %d", len(manifest.Added), len(manifest.Changed), len(manifest.Removed)))
 }
 
 func hideFiles() {
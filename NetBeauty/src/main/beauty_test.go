@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nulastudio/NetBeauty/src/manager"
+)
+
+// 设置该环境变量时测试程序作为nbeauty运行，每次运行都使用全新的全局状态
+const runAsBeauty = "NBEAUTY_TEST_RUN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runAsBeauty) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runBeauty 在子进程中运行nbeauty
+func runBeauty(t *testing.T, args ...string) (string, error) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runAsBeauty+"=1")
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	os.MkdirAll(filepath.Dir(path), 0777)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// writeApp 生成一个依赖libs中各个包（<name>.dll）的FDD应用
+func writeApp(t *testing.T, dir string, app string, libs map[string]string) {
+	targets := []string{fmt.Sprintf(`"%s/1.0.0": {"runtime": {"%s.dll": {}}}`, app, app)}
+	libraries := []string{fmt.Sprintf(`"%s/1.0.0": {"type": "project", "serviceable": false, "sha512": ""}`, app)}
+
+	for name, content := range libs {
+		targets = append(targets, fmt.Sprintf(`"%s/1.0.0": {"runtime": {"lib/net6.0/%s.dll": {}}}`, name, name))
+		libraries = append(libraries, fmt.Sprintf(`"%s/1.0.0": {"type": "package", "serviceable": true, "sha512": "", "path": "%s/1.0.0"}`, name, strings.ToLower(name)))
+		writeFile(t, filepath.Join(dir, name+".dll"), content)
+	}
+
+	writeFile(t, filepath.Join(dir, app+".deps.json"), fmt.Sprintf(`{
+  "runtimeTarget": {"name": ".NETCoreApp,Version=v6.0", "signature": ""},
+  "compilationOptions": {},
+  "targets": {".NETCoreApp,Version=v6.0": {%s}},
+  "libraries": {%s}
+}`, strings.Join(targets, ",\n"), strings.Join(libraries, ",\n")))
+	writeFile(t, filepath.Join(dir, app+".runtimeconfig.json"), `{
+  "runtimeOptions": {
+    "tfm": "net6.0",
+    "framework": {"name": "Microsoft.NETCore.App", "version": "6.0.0"}
+  }
+}`)
+	writeFile(t, filepath.Join(dir, app+".dll"), app)
+}
+
+func TestRerunReplacesPreviousRun(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	writeApp(t, dir, "App", map[string]string{"Lib": "v1"})
+	if output, err := runBeauty(t, dir, "libs"); err != nil {
+		t.Fatalf("first run: %v\n%s", err, output)
+	}
+
+	// 增量构建：输出目录中重新生成deps.json及更新后的dll，libs中保留上次的旧文件
+	writeApp(t, dir, "App", map[string]string{"Lib": "v2"})
+	if output, err := runBeauty(t, dir, "libs"); err != nil {
+		t.Fatalf("second run: %v\n%s", err, output)
+	}
+
+	if content := readFile(t, filepath.Join(dir, "libs", "Lib.dll")); content != "v2" {
+		t.Errorf("libs/Lib.dll = %q, want v2", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Lib.dll")); err == nil {
+		t.Error("Lib.dll left in the root")
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	app1 := filepath.Join(dir, "app1")
+	app2 := filepath.Join(dir, "app2")
+	writeFile(t, filepath.Join(app1, "Lib.dll"), "v1")
+	writeFile(t, filepath.Join(app2, "Lib.dll"), "v2")
+	// 上次运行留下的文件不算冲突
+	writeFile(t, filepath.Join(dir, "libs", "Lib.dll"), "old")
+
+	deps := []manager.Deps{{Name: "Lib.dll", Path: "lib/net6.0/Lib.dll", SecondPath: "Lib.dll", Type: manager.Assembly}}
+
+	if conflicts := findConflicts([]depsPlan{{baseDir: app1, libsDir: "../libs", deps: deps}}); len(conflicts) != 0 {
+		t.Errorf("stale target reported: %v", conflicts)
+	}
+
+	conflicts := findConflicts([]depsPlan{
+		{baseDir: app1, libsDir: "../libs", deps: deps},
+		{baseDir: app2, libsDir: "../libs", deps: deps},
+	})
+	if len(conflicts) != 1 || conflicts[0].Source != filepath.Join(app2, "Lib.dll") || conflicts[0].Target != filepath.Join(app1, "Lib.dll") {
+		t.Errorf("conflicts = %v", conflicts)
+	}
+}
+
+func TestConflictAbortKeepsSatellites(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	assembly := readFile(t, filepath.Join("..", "pe", "testdata", "System.ValueTuple.dll"))
+
+	// 两个配置共享libsDir，同名程序集内容不同
+	writeFile(t, filepath.Join(dir, "App.exe"), "")
+	writeFile(t, filepath.Join(dir, "App.exe.config"), "<configuration/>")
+	writeFile(t, filepath.Join(dir, "Lib.dll"), assembly)
+	writeFile(t, filepath.Join(dir, "plugins", "P.dll"), "")
+	writeFile(t, filepath.Join(dir, "plugins", "P.dll.config"), "<configuration/>")
+	writeFile(t, filepath.Join(dir, "plugins", "Lib.dll"), assembly+"x")
+	writeFile(t, filepath.Join(dir, "de", "App.resources.dll"), assembly)
+
+	output, err := runBeauty(t, "--cultures=en", "--fxconfigs=plugins/P.dll.config=../libs", dir, "libs")
+	if err == nil || !strings.Contains(output, "1 conflicts found") {
+		t.Fatalf("conflict not reported: %v\n%s", err, output)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "de", "App.resources.dll")); err != nil {
+		t.Errorf("filtered satellite removed before the conflict check: %v", err)
+	}
+}
+
+func TestSharedRuntimeMappingPerApp(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	writeApp(t, dir, "App1", map[string]string{"A": "a"})
+	writeApp(t, dir, "App2", map[string]string{"B": "b"})
+
+	if output, err := runBeauty(t, "--srmode", dir, "libs"); err != nil {
+		t.Fatalf("%v\n%s", err, output)
+	}
+
+	for app, want := range map[string]string{"App1": "A.dll:" + md5String("a"), "App2": "B.dll:" + md5String("b")} {
+		config := readFile(t, filepath.Join(dir, app+".runtimeconfig.json"))
+		mapping := regexp.MustCompile(`"NetBeautySharedRuntimeMapping":\s*"([^"]*)"`).FindStringSubmatch(config)
+		if mapping == nil || mapping[1] != want {
+			t.Errorf("%s: mapping = %v, want %q", app, mapping, want)
+		}
+	}
+}
+
+func md5String(content string) string {
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestOutNotCreatedForMalformedJSON(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	app := filepath.Join(dir, "app")
+	out := filepath.Join(dir, "out")
+	writeApp(t, app, "App", map[string]string{"Lib": "v1"})
+	writeFile(t, filepath.Join(app, "App.deps.json"), "{")
+
+	if output, err := runBeauty(t, "--out="+out, app, "libs"); err == nil {
+		t.Fatalf("malformed deps.json accepted\n%s", output)
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("out created for a malformed app")
+	}
+}
+
+func TestPlacedCopiesAreNotOrphans(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	writeApp(t, dir, "App", map[string]string{"Lib": "v1"})
+	writeFile(t, filepath.Join(dir, "Stray.dll"), "stray")
+
+	// --noruntimeinfo与SCD模式一样会删除deps.json中已移动文件的条目
+	output, err := runBeauty(t, "--loglevel=Detail", "--noruntimeinfo", "--link-mode=copy", "--orphans=quarantine", dir, "libs")
+	if err != nil {
+		t.Fatalf("%v\n%s", err, output)
+	}
+
+	if content := readFile(t, filepath.Join(dir, "Lib.dll")); content != "v1" {
+		t.Errorf("Lib.dll = %q, want the copied original", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, orphansDir, "Lib.dll")); err == nil {
+		t.Error("copied original quarantined as an orphan")
+	}
+	if _, err := os.Stat(filepath.Join(dir, orphansDir, "Stray.dll")); err != nil {
+		t.Errorf("real orphan not quarantined: %v", err)
+	}
+}
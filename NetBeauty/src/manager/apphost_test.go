@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nulastudio/NetBeauty/src/pe"
+)
+
+// writeAppHost 以pe测试中的程序集加上1025字节的入口槽模拟Windows apphost
+func writeAppHost(t *testing.T, dir string, entry string) string {
+	data, err := ioutil.ReadFile("../pe/testdata/System.ValueTuple.dll")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot := make([]byte, 1025)
+	copy(slot[1:], entry)
+	// 入口槽之后必须还有数据才能被识别
+	data = append(append(data, slot...), 0)
+
+	appHost := filepath.Join(dir, "App.exe")
+	if err := ioutil.WriteFile(appHost, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return appHost
+}
+
+func TestPatchAppHostCheckSum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	apphost := AnalyzeAppHost("App", writeAppHost(t, dir, "App.dll"))
+	// 识别出的入口包含结尾的\0
+	if strings.TrimRight(apphost.Entry, "\x00") != "App.dll" || apphost.Subsystem != "console" {
+		t.Fatalf("AnalyzeAppHost = %+v", apphost)
+	}
+
+	entryPatched, subsystemPatched := PatchAppHost(apphost, AppHostPatch{Entry: "bin/App.dll", Subsystem: "gui"})
+	if !entryPatched || !subsystemPatched {
+		t.Fatalf("PatchAppHost = %v, %v", entryPatched, subsystemPatched)
+	}
+
+	data, _ := ioutil.ReadFile(apphost.Location)
+	header, err := pe.ReadHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Subsystem != pe.SubsystemGUI {
+		t.Errorf("Subsystem = %d, want %d", header.Subsystem, pe.SubsystemGUI)
+	}
+
+	// 入口修改后校验和仍然有效
+	verify := append([]byte{}, data...)
+	if err := pe.UpdateCheckSum(verify); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := pe.ReadHeader(verify); again.CheckSum != header.CheckSum {
+		t.Errorf("CheckSum = 0x%x, want 0x%x", header.CheckSum, again.CheckSum)
+	}
+
+	if patched := AnalyzeAppHost("App", apphost.Location); strings.TrimRight(patched.Entry, "\x00") != "bin/App.dll" {
+		t.Errorf("Entry = %q, want %q", patched.Entry, "bin/App.dll")
+	}
+}
+
+func TestPatchAppHostSubsystemNotPE(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	slot := make([]byte, 1025)
+	copy(slot[1:], "App.dll")
+	appHost := filepath.Join(dir, "App")
+	ioutil.WriteFile(appHost, append(append([]byte("\x7fELF\x00"), slot...), 0), 0777)
+
+	apphost := AnalyzeAppHost("App", appHost)
+	entryPatched, subsystemPatched := PatchAppHost(apphost, AppHostPatch{Entry: "bin/App.dll", Subsystem: "gui"})
+	if !entryPatched || subsystemPatched {
+		t.Errorf("PatchAppHost = %v, %v, want true, false", entryPatched, subsystemPatched)
+	}
+}
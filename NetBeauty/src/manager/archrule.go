@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/beevik/etree"
+
+	log "github.com/nulastudio/NetBeauty/src/log"
+	"github.com/nulastudio/NetBeauty/src/util"
+)
+
+// NativeArchDirs .NET Framework包按处理器架构存放native的目录
+var NativeArchDirs = []string{"x86", "x64", "arm", "arm64"}
+
+// NativeArchRule 使用架构目录的包及其查找native的约定
+type NativeArchRule struct {
+	Package  string
+	Assembly string
+	Natives  []string
+
+	// ConfigFile 包自身读取设置的配置文件，与Assembly位于同一目录
+	ConfigFile string
+	Settings   map[string]string
+}
+
+// NativeArchRules 已知的使用架构目录的包
+var NativeArchRules = []NativeArchRule{
+	{
+		// System.Data.SQLite从程序集所在目录下的<arch>/SQLite.Interop.dll预加载native
+		// 设置只从环境变量及System.Data.SQLite.dll.config中读取，不读取exe.config
+		Package:    "System.Data.SQLite",
+		Assembly:   "System.Data.SQLite.dll",
+		Natives:    []string{"SQLite.Interop.dll"},
+		ConfigFile: "System.Data.SQLite.dll.config",
+		Settings: map[string]string{
+			"PreLoadSQLite_UseAssemblyDirectory": "true",
+		},
+	},
+}
+
+// FindNativeArchRule 根据架构目录中的文件查找对应的包
+func FindNativeArchRule(files []string) *NativeArchRule {
+	for i, rule := range NativeArchRules {
+		for _, native := range rule.Natives {
+			for _, file := range files {
+				if file == native {
+					return &NativeArchRules[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// WriteAppSettings 写入appSettings，已存在的key原位修改，文件不存在时创建
+func WriteAppSettings(config string, settings map[string]string) bool {
+	doc := etree.NewDocument()
+
+	if util.PathExists(config) {
+		if err := doc.ReadFromFile(config); err != nil {
+			log.LogError(fmt.Errorf("can not read config: %s : %s", config, err.Error()), false)
+			return false
+		}
+	} else {
+		doc.CreateProcInst("xml", `version="1.0" encoding="utf-8"`)
+	}
+
+	configuration := doc.SelectElement("configuration")
+	if configuration == nil {
+		configuration = doc.CreateElement("configuration")
+	}
+
+	appSettings := configuration.SelectElement("appSettings")
+	if appSettings == nil {
+		appSettings = configuration.CreateElement("appSettings")
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		add := appSettings.FindElement(fmt.Sprintf("./add[@key='%s']", key))
+		if add == nil {
+			add = appSettings.CreateElement("add")
+			add.CreateAttr("key", key)
+		}
+		add.CreateAttr("value", settings[key])
+	}
+
+	doc.WriteSettings.UseCRLF = true
+
+	doc.Indent(2)
+
+	bytes, _ := doc.WriteToBytes()
+
+	if err := ioutil.WriteFile(config, bytes, 0666); err != nil {
+		log.LogError(fmt.Errorf("write config failed: %s : %s", config, err.Error()), false)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,208 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+
+	log "github.com/nulastudio/NetBeauty/src/log"
+	"github.com/nulastudio/NetBeauty/src/pe"
+)
+
+type localAssembly struct {
+	Identity *pe.AssemblyIdentity
+	File     string
+}
+
+type assemblyReference struct {
+	Identity pe.AssemblyIdentity
+	File     string
+}
+
+// readAssemblies 读取所有程序集的标识及引用，非托管文件忽略
+func readAssemblies(dir string, files []string) (map[string]localAssembly, map[string][]assemblyReference) {
+	locals := make(map[string]localAssembly)
+	references := make(map[string][]assemblyReference)
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			continue
+		}
+
+		metadata, err := pe.ReadMetadata(content)
+		if err != nil || metadata.Assembly == nil {
+			continue
+		}
+
+		key := strings.ToLower(metadata.Assembly.Name)
+		if _, ok := locals[key]; !ok {
+			locals[key] = localAssembly{Identity: metadata.Assembly, File: file}
+		}
+
+		for _, reference := range metadata.References {
+			key := strings.ToLower(reference.Name)
+			references[key] = append(references[key], assemblyReference{Identity: reference, File: file})
+		}
+	}
+
+	return locals, references
+}
+
+// fixBindingRedirects 根据程序集元数据生成或修复bindingRedirect，无法处理的冲突只做报告
+func fixBindingRedirects(dir string, files []string, assemblyBindings []*etree.Element) {
+	locals, references := readAssemblies(dir, files)
+
+	names := make([]string, 0, len(references))
+	for name := range references {
+		if _, ok := locals[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		local := locals[name]
+		identity := local.Identity
+
+		// 只有强名称程序集才会校验版本
+		if identity.PublicKeyToken == "null" || identity.Culture != "neutral" {
+			continue
+		}
+
+		conflict := false
+		needRedirect := false
+
+		for _, reference := range references[name] {
+			if reference.Identity.PublicKeyToken != "null" && reference.Identity.PublicKeyToken != identity.PublicKeyToken {
+				log.LogError(fmt.Errorf("binding conflict: %s references %s, but %s is PublicKeyToken=%s", reference.File, reference.Identity.String(), local.File, identity.PublicKeyToken), false)
+				conflict = true
+			} else if pe.CompareVersion(reference.Identity.Version, identity.Version) > 0 {
+				log.LogError(fmt.Errorf("binding conflict: %s references %s, but %s is only Version=%s", reference.File, reference.Identity.String(), local.File, identity.Version), false)
+				conflict = true
+			} else if reference.Identity.Version != identity.Version {
+				needRedirect = true
+			}
+		}
+
+		if conflict {
+			continue
+		}
+
+		dependentAssembly, redirects := findDependentAssembly(assemblyBindings, identity)
+
+		if dependentAssembly == nil {
+			if !needRedirect {
+				continue
+			}
+
+			dependentAssembly = assemblyBindings[0].CreateElement("dependentAssembly")
+			assemblyIdentity := dependentAssembly.CreateElement("assemblyIdentity")
+			assemblyIdentity.CreateAttr("name", identity.Name)
+			assemblyIdentity.CreateAttr("publicKeyToken", identity.PublicKeyToken)
+			assemblyIdentity.CreateAttr("culture", identity.Culture)
+			bindingRedirect := dependentAssembly.CreateElement("bindingRedirect")
+			bindingRedirect.CreateAttr("oldVersion", "0.0.0.0-"+identity.Version)
+			bindingRedirect.CreateAttr("newVersion", identity.Version)
+
+			log.LogDetail(fmt.Sprintf("bindingRedirect generated: %s 0.0.0.0-%s => %s", identity.Name, identity.Version, identity.Version))
+			continue
+		}
+
+		if redirectsSatisfied(redirects, references[name], identity.Version) {
+			continue
+		}
+
+		// 重定向的目标版本与实际文件不一致，或未覆盖所有引用的版本
+		if len(redirects) > 1 {
+			for _, redirect := range redirects[1:] {
+				dependentAssembly.RemoveChild(redirect)
+			}
+		}
+
+		bindingRedirect := dependentAssembly.SelectElement("bindingRedirect")
+		if bindingRedirect == nil {
+			bindingRedirect = dependentAssembly.CreateElement("bindingRedirect")
+		}
+		bindingRedirect.CreateAttr("oldVersion", "0.0.0.0-"+identity.Version)
+		bindingRedirect.CreateAttr("newVersion", identity.Version)
+
+		log.LogDetail(fmt.Sprintf("bindingRedirect repaired: %s 0.0.0.0-%s => %s", identity.Name, identity.Version, identity.Version))
+	}
+}
+
+// findDependentAssembly 查找程序集对应的dependentAssembly及其bindingRedirect
+func findDependentAssembly(assemblyBindings []*etree.Element, identity *pe.AssemblyIdentity) (*etree.Element, []*etree.Element) {
+	for _, assemblyBinding := range assemblyBindings {
+		for _, dependentAssembly := range assemblyBinding.SelectElements("dependentAssembly") {
+			assemblyIdentity := dependentAssembly.SelectElement("assemblyIdentity")
+			if assemblyIdentity == nil {
+				continue
+			}
+
+			if !strings.EqualFold(assemblyIdentity.SelectAttrValue("name", ""), identity.Name) {
+				continue
+			}
+
+			token := assemblyIdentity.SelectAttrValue("publicKeyToken", "")
+			if token != "" && !strings.EqualFold(token, identity.PublicKeyToken) {
+				continue
+			}
+
+			return dependentAssembly, dependentAssembly.SelectElements("bindingRedirect")
+		}
+	}
+
+	return nil, nil
+}
+
+// redirectsSatisfied 所有引用的版本是否都被重定向到了实际版本，且没有重定向到其它版本
+func redirectsSatisfied(redirects []*etree.Element, references []assemblyReference, version string) bool {
+	if len(redirects) == 0 {
+		for _, reference := range references {
+			if reference.Identity.Version != version {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, redirect := range redirects {
+		if redirect.SelectAttrValue("newVersion", "") != version {
+			return false
+		}
+	}
+
+	for _, reference := range references {
+		if reference.Identity.Version == version {
+			continue
+		}
+
+		covered := false
+		for _, redirect := range redirects {
+			low, high := versionRange(redirect.SelectAttrValue("oldVersion", ""))
+			if pe.CompareVersion(reference.Identity.Version, low) >= 0 && pe.CompareVersion(reference.Identity.Version, high) <= 0 {
+				covered = true
+				break
+			}
+		}
+
+		if !covered {
+			return false
+		}
+	}
+
+	return true
+}
+
+func versionRange(oldVersion string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(oldVersion), "-", 2)
+	if len(parts) == 1 {
+		return parts[0], parts[0]
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
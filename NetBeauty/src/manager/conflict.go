@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/nulastudio/NetBeauty/src/pe"
+	"github.com/nulastudio/NetBeauty/src/util"
+)
+
+// FileConflict 移动的目标文件已存在且内容不同（多个应用共享同一个libsDir）
+type FileConflict struct {
+	Source        string
+	Target        string
+	SourceHash    string
+	TargetHash    string
+	SourceVersion string
+	TargetVersion string
+	// SourceFileVersion 版本资源中的文件版本，程序集版本相同时用于比较
+	SourceFileVersion string
+	TargetFileVersion string
+}
+
+// DetectConflict 检查目标文件是否已存在且内容不同，不冲突时返回nil
+func DetectConflict(source string, target string) *FileConflict {
+	if !util.PathExists(target) {
+		return nil
+	}
+
+	sourceHash, _ := util.GetFileMD5(source)
+	targetHash, _ := util.GetFileMD5(target)
+
+	if sourceHash == targetHash {
+		return nil
+	}
+
+	conflict := &FileConflict{
+		Source:     source,
+		Target:     target,
+		SourceHash: sourceHash,
+		TargetHash: targetHash,
+	}
+	conflict.SourceVersion, conflict.SourceFileVersion = fileVersions(source)
+	conflict.TargetVersion, conflict.TargetFileVersion = fileVersions(target)
+
+	return conflict
+}
+
+// fileVersions 程序集版本及文件版本，未知时为空
+func fileVersions(file string) (string, string) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", ""
+	}
+
+	assemblyVersion := ""
+	if metadata, err := pe.ReadMetadata(content); err == nil && metadata.Assembly != nil {
+		assemblyVersion = metadata.Assembly.Version
+	}
+
+	fileVersion, _ := pe.ReadFileVersion(content)
+
+	return assemblyVersion, fileVersion
+}
+
+// Compare 比较源文件与目标文件的版本，先比较程序集版本，相同或未知时比较文件版本
+// 版本都相同或未知（内容不同）时无法决定使用哪个文件，第二个返回值为false
+func (c *FileConflict) Compare() (int, bool) {
+	for _, versions := range [][2]string{{c.SourceVersion, c.TargetVersion}, {c.SourceFileVersion, c.TargetFileVersion}} {
+		if versions[0] == "" || versions[1] == "" {
+			continue
+		}
+		if result := pe.CompareVersion(versions[0], versions[1]); result != 0 {
+			return result, true
+		}
+	}
+	return 0, false
+}
+
+func (c *FileConflict) String() string {
+	var describe = func(file string, hash string, version string, fileVersion string) string {
+		attrs := ""
+		if version != "" {
+			attrs += "Version=" + version + ", "
+		}
+		if fileVersion != "" {
+			attrs += "FileVersion=" + fileVersion + ", "
+		}
+		return fmt.Sprintf("%s (%smd5 %s)", file, attrs, hash)
+	}
+	return fmt.Sprintf("conflict: %s => %s", describe(c.Source, c.SourceHash, c.SourceVersion, c.SourceFileVersion), describe(c.Target, c.TargetHash, c.TargetVersion, c.TargetFileVersion))
+}
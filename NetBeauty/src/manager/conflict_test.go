@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withFileVersion 修改VS_FIXEDFILEINFO中的文件版本，程序集版本不变
+func withFileVersion(t *testing.T, data []byte, build uint16) []byte {
+	data = append([]byte{}, data...)
+	signature := bytes.Index(data, []byte{0xbd, 0x04, 0xef, 0xfe})
+	if signature == -1 {
+		t.Fatal("VS_FIXEDFILEINFO not found")
+	}
+	binary.LittleEndian.PutUint16(data[signature+14:], build)
+	return data
+}
+
+func TestDetectConflict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture, err := ioutil.ReadFile("../pe/testdata/System.ValueTuple.dll")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name string, content []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, content, 0666); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// 同一程序集版本，只有文件版本或内容不同
+	newer := withFileVersion(t, fixture, 0xffff)
+	patched := append(append([]byte{}, fixture...), 0)
+
+	target := write("target.dll", fixture)
+
+	if conflict := DetectConflict(write("same.dll", fixture), target); conflict != nil {
+		t.Errorf("identical files: %s", conflict.String())
+	}
+	if conflict := DetectConflict(write("missing.dll", fixture), filepath.Join(dir, "none.dll")); conflict != nil {
+		t.Errorf("missing target: %s", conflict.String())
+	}
+
+	tests := []struct {
+		name       string
+		source     []byte
+		target     []byte
+		result     int
+		comparable bool
+	}{
+		{"higher file version", newer, fixture, 1, true},
+		{"lower file version", fixture, newer, -1, true},
+		// 版本完全相同但内容不同时无法判断
+		{"equal versions", patched, fixture, 0, false},
+		{"native", []byte("native 1"), []byte("native 2"), 0, false},
+	}
+
+	for _, test := range tests {
+		conflict := DetectConflict(write("source.dll", test.source), write("target.dll", test.target))
+		if conflict == nil {
+			t.Errorf("%s: no conflict", test.name)
+			continue
+		}
+
+		result, comparable := conflict.Compare()
+		if result != test.result || comparable != test.comparable {
+			t.Errorf("%s: Compare = %d, %v, want %d, %v (%s)", test.name, result, comparable, test.result, test.comparable, conflict.String())
+		}
+	}
+}
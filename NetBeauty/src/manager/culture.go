@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/nulastudio/NetBeauty/src/log"
+	"github.com/nulastudio/NetBeauty/src/util"
+)
+
+// Cultures 需要保留的卫星程序集语言，为空时全部保留
+var Cultures []string
+
+// 与.NET的父语言规则一致：zh-CN/zh-SG回退到zh-Hans，zh-TW/zh-HK/zh-MO回退到zh-Hant
+// zh-CHS/zh-CHT为旧名称
+var cultureParents = map[string]string{
+	"zh-cn":  "zh-hans",
+	"zh-sg":  "zh-hans",
+	"zh-chs": "zh-hans",
+	"zh-tw":  "zh-hant",
+	"zh-hk":  "zh-hant",
+	"zh-mo":  "zh-hant",
+	"zh-cht": "zh-hant",
+}
+
+// BCP-47语言标记：language[-script][-region][-variant...]，language只接受ISO 639的2-3个字母
+var cultureRegex = regexp.MustCompile(`(?i)^[a-z]{2,3}(-[a-z]{4})?(-(?:[a-z]{2}|[0-9]{3}))?(-(?:[a-z0-9]{5,8}|[0-9][a-z0-9]{3}))*$`)
+
+// IsCulture 是否为有效的语言名称，用于区分卫星程序集目录与plugins、libraries等普通目录
+func IsCulture(locale string) bool {
+	if _, ok := cultureParents[strings.ToLower(locale)]; ok {
+		return true
+	}
+	return cultureRegex.MatchString(locale)
+}
+
+// ParseCultures 解析以;分隔的语言列表
+func ParseCultures(cultures string) []string {
+	result := make([]string, 0)
+	for _, culture := range strings.Split(cultures, ";") {
+		culture = strings.TrimSpace(culture)
+		if culture != "" {
+			result = append(result, culture)
+		}
+	}
+	return result
+}
+
+// cultureChain 语言及其所有父语言（小写），如zh-TW => zh-tw, zh-hant, zh
+func cultureChain(culture string) []string {
+	chain := make([]string, 0)
+	culture = strings.ToLower(strings.ReplaceAll(culture, "_", "-"))
+
+	for culture != "" {
+		chain = append(chain, culture)
+
+		if parent, ok := cultureParents[culture]; ok {
+			culture = parent
+		} else if i := strings.LastIndex(culture, "-"); i != -1 {
+			culture = culture[:i]
+		} else {
+			culture = ""
+		}
+	}
+
+	return chain
+}
+
+// CultureAllowed 语言是否需要保留：指定语言本身、其父语言（资源回退）及其子语言
+func CultureAllowed(locale string) bool {
+	if len(Cultures) == 0 || locale == "" {
+		return true
+	}
+
+	localeChain := cultureChain(locale)
+
+	for _, culture := range Cultures {
+		chain := cultureChain(culture)
+		if containsFold(chain, localeChain[0]) || containsFold(localeChain, chain[0]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterSatellite 卫星程序集是否不需要保留，只做判断，删除由RemoveSatellites完成
+func filterSatellite(locale string, fileName string) bool {
+	if CultureAllowed(locale) {
+		return false
+	}
+
+	if !IsCulture(locale) {
+		log.LogDetail("not a culture, keep: " + locale + "/" + fileName)
+		return false
+	}
+
+	return true
+}
+
+// RemoveSatellites 删除被过滤的卫星程序集（路径相对于dir）及变为空的语言目录
+func RemoveSatellites(dir string, satellites []Deps) {
+	for _, satellite := range satellites {
+		path := filepath.Join(dir, filepath.FromSlash(satellite.Path))
+
+		if err := os.Remove(path); err == nil {
+			log.LogDetail("satellite assembly removed: " + satellite.Path)
+		}
+
+		// 只在目录为空时才会删除成功
+		os.Remove(filepath.Dir(path))
+	}
+}
+
+// SatelliteSlot 选择SRM模式下存放应用卫星程序集的目录<localesDir>/<n>，satellites为<culture>/<file>到源文件的映射
+// host按<probe>/<culture>/<file>查找并使用第一个存在的文件，一个应用的卫星程序集全部放在同一目录中，只需一个探测路径
+// 内容相同的文件在应用间共享，存在同名但内容不同的文件时使用下一个目录
+func SatelliteSlot(localesDir string, satellites map[string]string) string {
+	for slot := 0; ; slot++ {
+		dir := filepath.Join(localesDir, strconv.Itoa(slot))
+
+		fits := true
+		for target, source := range satellites {
+			existing := filepath.Join(dir, filepath.FromSlash(target))
+			if !util.PathExists(existing) {
+				continue
+			}
+
+			existingMD5, _ := util.GetFileMD5(existing)
+			sourceMD5, _ := util.GetFileMD5(source)
+			if existingMD5 == "" || existingMD5 != sourceMD5 {
+				fits = false
+				break
+			}
+		}
+
+		if fits {
+			return strconv.Itoa(slot)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSatelliteSlot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(path string, content string) string {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(path), 0777)
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	locales := filepath.Join(dir, "libraries", "locales")
+
+	write("libraries/locales/0/de/A.resources.dll", "a1")
+	write("libraries/locales/0/de/B.resources.dll", "b1")
+	write("libraries/locales/1/de/A.resources.dll", "a2")
+
+	tests := []struct {
+		name       string
+		satellites map[string]string
+		slot       string
+	}{
+		{"empty", map[string]string{}, "0"},
+		{"identical files are shared", map[string]string{
+			"de/A.resources.dll": write("app1/de/A.resources.dll", "a1"),
+			"zh/A.resources.dll": write("app1/zh/A.resources.dll", "za"),
+		}, "0"},
+		// 所有卫星程序集必须在同一目录中
+		{"one conflict moves the whole app", map[string]string{
+			"de/A.resources.dll": write("app2/de/A.resources.dll", "a2"),
+			"de/B.resources.dll": write("app2/de/B.resources.dll", "b1"),
+		}, "1"},
+		{"no free slot", map[string]string{
+			"de/A.resources.dll": write("app3/de/A.resources.dll", "a3"),
+		}, "2"},
+	}
+
+	for _, test := range tests {
+		if slot := SatelliteSlot(locales, test.satellites); slot != test.slot {
+			t.Errorf("%s: SatelliteSlot = %s, want %s", test.name, slot, test.slot)
+		}
+	}
+}
+
+func TestIsCulture(t *testing.T) {
+	tests := []struct {
+		locale  string
+		culture bool
+	}{
+		{"de", true},
+		{"zh-Hans", true},
+		{"zh-CHS", true},
+		{"pt-BR", true},
+		{"es-419", true},
+		{"sr-Latn-RS", true},
+		{"ca-ES-valencia", true},
+		{"plugins", false},
+		{"libraries", false},
+		{"runtimes", false},
+		{"en_US", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if culture := IsCulture(test.locale); culture != test.culture {
+			t.Errorf("IsCulture(%q) = %v, want %v", test.locale, culture, test.culture)
+		}
+	}
+}
+
+func TestFilterSatelliteKeepsNonCultures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{"de/A.resources.dll", "plugins/A.resources.dll"} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(path), 0777)
+		ioutil.WriteFile(path, nil, 0666)
+	}
+
+	Cultures = []string{"en"}
+	defer func() { Cultures = nil }()
+
+	if !filterSatellite("de", "A.resources.dll") {
+		t.Error("de: not filtered")
+	}
+	if filterSatellite("plugins", "A.resources.dll") {
+		t.Error("plugins: filtered")
+	}
+
+	// 只做判断，文件在RemoveSatellites中才删除
+	if _, err := os.Stat(filepath.Join(dir, "de", "A.resources.dll")); err != nil {
+		t.Error("de: removed while filtering")
+	}
+
+	RemoveSatellites(dir, []Deps{{Name: "A.resources.dll", Path: "de/A.resources.dll", Type: Resource, Locale: "de"}})
+	if _, err := os.Stat(filepath.Join(dir, "de")); !os.IsNotExist(err) {
+		t.Error("de: empty culture directory is kept")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "plugins", "A.resources.dll")); err != nil {
+		t.Error("plugins: " + err.Error())
+	}
+}
@@ -0,0 +1,604 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nulastudio/NetBeauty/src/ojson"
+	"github.com/nulastudio/NetBeauty/src/util"
+)
+
+// DepsAssetKind deps.json中依赖项的资源类别
+type DepsAssetKind string
+
+const (
+	RuntimeAsset       DepsAssetKind = "runtime"
+	NativeAsset        DepsAssetKind = "native"
+	RuntimeTargetAsset DepsAssetKind = "runtimeTargets"
+	ResourceAsset      DepsAssetKind = "resources"
+	CompileAsset       DepsAssetKind = "compile"
+)
+
+// depsAssetKinds 新增资源类别时的写入顺序（与dotnet sdk一致）
+var depsAssetKinds = []DepsAssetKind{
+	RuntimeAsset,
+	NativeAsset,
+	RuntimeTargetAsset,
+	ResourceAsset,
+	CompileAsset,
+}
+
+// DepsJSON deps.json
+type DepsJSON struct {
+	RuntimeTarget      *DepsRuntimeTarget
+	CompilationOptions *DepsCompilationOptions
+	Targets            []*DepsTarget
+	Libraries          []*DepsLibrary
+
+	raw    *ojson.Object
+	format ojson.Format
+}
+
+// DepsRuntimeTarget deps.json中的runtimeTarget
+type DepsRuntimeTarget struct {
+	Name      string
+	Signature string
+
+	raw *ojson.Object
+}
+
+// DepsCompilationOptions deps.json中的compilationOptions（PreserveCompilationContext）
+type DepsCompilationOptions struct {
+	Defines                  []string
+	LanguageVersion          string
+	Platform                 string
+	KeyFile                  string
+	DebugType                string
+	AllowUnsafe              *bool
+	WarningsAsErrors         *bool
+	Optimize                 *bool
+	DelaySign                *bool
+	PublicSign               *bool
+	EmitEntryPoint           *bool
+	GenerateXMLDocumentation *bool
+
+	raw *ojson.Object
+}
+
+// DepsTarget deps.json中的target
+type DepsTarget struct {
+	Name      string
+	Libraries []*DepsTargetLibrary
+}
+
+// DepsTargetLibrary target下的依赖项
+type DepsTargetLibrary struct {
+	Name         string
+	Dependencies *ojson.Object
+	Assets       map[DepsAssetKind][]*DepsAsset
+
+	raw *ojson.Object
+}
+
+// DepsAsset 依赖项中的单个文件
+type DepsAsset struct {
+	Path            string
+	Rid             string
+	AssetType       string
+	Locale          string
+	AssemblyVersion string
+	FileVersion     string
+
+	raw *ojson.Object
+}
+
+// DepsLibrary deps.json中的library
+type DepsLibrary struct {
+	Name        string
+	Type        string
+	Serviceable bool
+	Sha512      string
+	Path        string
+	HashPath    string
+
+	raw *ojson.Object
+}
+
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// jsonPath 拼接JSON路径，用于错误提示
+func jsonPath(parent string, key string) string {
+	if identifierRegex.MatchString(key) {
+		return parent + "." + key
+	}
+	quoted, _ := ojson.Marshal(key)
+	return parent + "[" + string(quoted) + "]"
+}
+
+// setString 原本存在的键总是写回（包括空字符串），不存在的键只在非空时写入
+func setString(object *ojson.Object, key string, value string) {
+	if value != "" || object.Has(key) {
+		object.Set(key, value)
+	}
+}
+
+// ParseDepsJSON 解析deps.json
+func ParseDepsJSON(data []byte) (*DepsJSON, error) {
+	depsJSON := &DepsJSON{}
+
+	format, err := ojson.Unmarshal(data, depsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	depsJSON.format = format
+
+	return depsJSON, nil
+}
+
+// Bytes 按原始格式编码deps.json
+func (d *DepsJSON) Bytes() ([]byte, error) {
+	return ojson.MarshalFormat(d, d.format)
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，遇到不符合结构的节点时返回第一个错误
+func (d *DepsJSON) UnmarshalJSON(data []byte) error {
+	dec := &schemaDecoder{}
+	d.decode(dec, data)
+	return dec.err()
+}
+
+// decode 按deps.json结构解码，不符合结构的节点记录到dec中并跳过
+func (d *DepsJSON) decode(dec *schemaDecoder, data []byte) {
+	d.raw = ojson.NewObject()
+	d.format = ojson.DefaultFormat
+	d.Targets = make([]*DepsTarget, 0)
+	d.Libraries = make([]*DepsLibrary, 0)
+
+	root := dec.object(data, "$")
+	if root == nil {
+		return
+	}
+	d.raw = root
+
+	if runtimeTarget := dec.memberObject(root, "runtimeTarget", "$"); runtimeTarget != nil {
+		d.RuntimeTarget = &DepsRuntimeTarget{raw: runtimeTarget}
+		dec.str(runtimeTarget, "name", "$.runtimeTarget", &d.RuntimeTarget.Name, true)
+		dec.str(runtimeTarget, "signature", "$.runtimeTarget", &d.RuntimeTarget.Signature, false)
+	}
+
+	if options := dec.memberObject(root, "compilationOptions", "$"); options != nil {
+		d.CompilationOptions = decodeCompilationOptions(dec, options, "$.compilationOptions")
+	}
+
+	if targets := dec.memberObject(root, "targets", "$"); targets != nil {
+		for _, targetName := range targets.Keys() {
+			targetPath := jsonPath("$.targets", targetName)
+			libraries := dec.object(targets.Raw(targetName), targetPath)
+			if libraries == nil {
+				continue
+			}
+
+			target := &DepsTarget{
+				Name:      targetName,
+				Libraries: make([]*DepsTargetLibrary, 0),
+			}
+
+			for _, libName := range libraries.Keys() {
+				if library := decodeTargetLibrary(dec, libName, libraries.Raw(libName), jsonPath(targetPath, libName)); library != nil {
+					target.Libraries = append(target.Libraries, library)
+				}
+			}
+
+			d.Targets = append(d.Targets, target)
+		}
+	}
+
+	if libraries := dec.memberObject(root, "libraries", "$"); libraries != nil {
+		for _, libName := range libraries.Keys() {
+			libPath := jsonPath("$.libraries", libName)
+			object := dec.object(libraries.Raw(libName), libPath)
+			if object == nil {
+				continue
+			}
+
+			library := &DepsLibrary{Name: libName, raw: object}
+
+			dec.str(object, "type", libPath, &library.Type, false)
+			dec.boolean(object, "serviceable", libPath, &library.Serviceable)
+			dec.str(object, "sha512", libPath, &library.Sha512, false)
+			dec.str(object, "path", libPath, &library.Path, false)
+			dec.str(object, "hashPath", libPath, &library.HashPath, false)
+
+			d.Libraries = append(d.Libraries, library)
+		}
+	}
+}
+
+func decodeCompilationOptions(dec *schemaDecoder, object *ojson.Object, path string) *DepsCompilationOptions {
+	options := &DepsCompilationOptions{raw: object}
+
+	dec.strings(object, "defines", path, &options.Defines)
+
+	// 以下键在sdk生成的文件中可能为null
+	for _, field := range []struct {
+		key string
+		v   *string
+	}{
+		{"languageVersion", &options.LanguageVersion},
+		{"platform", &options.Platform},
+		{"keyFile", &options.KeyFile},
+		{"debugType", &options.DebugType},
+	} {
+		if raw := object.Raw(field.key); raw != nil && ojson.Kind(raw) != "null" {
+			dec.str(object, field.key, path, field.v, false)
+		}
+	}
+
+	for _, field := range []struct {
+		key string
+		v   **bool
+	}{
+		{"allowUnsafe", &options.AllowUnsafe},
+		{"warningsAsErrors", &options.WarningsAsErrors},
+		{"optimize", &options.Optimize},
+		{"delaySign", &options.DelaySign},
+		{"publicSign", &options.PublicSign},
+		{"emitEntryPoint", &options.EmitEntryPoint},
+		{"xmlDoc", &options.GenerateXMLDocumentation},
+	} {
+		if raw := object.Raw(field.key); raw != nil && ojson.Kind(raw) != "null" {
+			var value bool
+			if dec.boolean(object, field.key, path, &value) {
+				*field.v = &value
+			}
+		}
+	}
+
+	return options
+}
+
+func decodeTargetLibrary(dec *schemaDecoder, name string, raw json.RawMessage, path string) *DepsTargetLibrary {
+	object := dec.object(raw, path)
+	if object == nil {
+		return nil
+	}
+
+	library := &DepsTargetLibrary{
+		Name:   name,
+		Assets: make(map[DepsAssetKind][]*DepsAsset),
+		raw:    object,
+	}
+
+	if dependencies := dec.memberObject(object, "dependencies", path); dependencies != nil {
+		library.Dependencies = dependencies
+		// 依赖项的值为版本号
+		for _, dependency := range dependencies.Keys() {
+			var version string
+			dec.str(dependencies, dependency, jsonPath(path, "dependencies"), &version, true)
+		}
+	}
+
+	for _, kind := range depsAssetKinds {
+		kindPath := jsonPath(path, string(kind))
+		assets := dec.memberObject(object, string(kind), path)
+		if assets == nil {
+			continue
+		}
+
+		library.Assets[kind] = make([]*DepsAsset, 0)
+
+		for _, assetPath := range assets.Keys() {
+			if asset := decodeAsset(dec, kind, assetPath, assets.Raw(assetPath), jsonPath(kindPath, assetPath)); asset != nil {
+				library.Assets[kind] = append(library.Assets[kind], asset)
+			}
+		}
+	}
+
+	return library
+}
+
+func decodeAsset(dec *schemaDecoder, kind DepsAssetKind, assetPath string, raw json.RawMessage, path string) *DepsAsset {
+	object := dec.object(raw, path)
+	if object == nil {
+		return nil
+	}
+
+	asset := &DepsAsset{Path: assetPath, raw: object}
+
+	// runtimeTargets必须带有rid及assetType，resources必须带有locale
+	dec.str(object, "rid", path, &asset.Rid, kind == RuntimeTargetAsset)
+	dec.str(object, "assetType", path, &asset.AssetType, kind == RuntimeTargetAsset)
+	dec.str(object, "locale", path, &asset.Locale, kind == ResourceAsset)
+	dec.str(object, "assemblyVersion", path, &asset.AssemblyVersion, false)
+	dec.str(object, "fileVersion", path, &asset.FileVersion, false)
+
+	if kind == RuntimeTargetAsset && asset.AssetType != "" && asset.AssetType != "runtime" && asset.AssetType != "native" {
+		dec.report(jsonPath(path, "assetType"), `"runtime" or "native"`, fmt.Sprintf("%q", asset.AssetType))
+	}
+
+	return asset
+}
+
+// MarshalJSON 实现json.Marshaler
+func (d *DepsJSON) MarshalJSON() ([]byte, error) {
+	root := d.raw
+	if root == nil {
+		root = ojson.NewObject()
+		d.raw = root
+	}
+
+	if d.RuntimeTarget != nil {
+		if err := root.Set("runtimeTarget", d.RuntimeTarget); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.CompilationOptions != nil {
+		if err := root.Set("compilationOptions", d.CompilationOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	// 原本不存在且为空时不写入，保证只有实际改动
+	if len(d.Targets) != 0 || root.Has("targets") {
+		targets, err := d.targetsObject()
+		if err != nil {
+			return nil, err
+		}
+		if err := root.Set("targets", targets); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(d.Libraries) != 0 || root.Has("libraries") {
+		libraries := ojson.NewObject()
+		for _, library := range d.Libraries {
+			if err := libraries.Set(library.Name, library); err != nil {
+				return nil, err
+			}
+		}
+		if err := root.Set("libraries", libraries); err != nil {
+			return nil, err
+		}
+	}
+
+	return root.MarshalJSON()
+}
+
+func (d *DepsJSON) targetsObject() (*ojson.Object, error) {
+	targets := ojson.NewObject()
+	for _, target := range d.Targets {
+		libraries := ojson.NewObject()
+		for _, library := range target.Libraries {
+			if err := libraries.Set(library.Name, library); err != nil {
+				return nil, err
+			}
+		}
+		if err := targets.Set(target.Name, libraries); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// MarshalJSON 实现json.Marshaler
+func (r *DepsRuntimeTarget) MarshalJSON() ([]byte, error) {
+	if r.raw == nil {
+		r.raw = ojson.NewObject()
+	}
+	setString(r.raw, "name", r.Name)
+	setString(r.raw, "signature", r.Signature)
+	return r.raw.MarshalJSON()
+}
+
+// MarshalJSON 实现json.Marshaler
+func (o *DepsCompilationOptions) MarshalJSON() ([]byte, error) {
+	if o.raw == nil {
+		o.raw = ojson.NewObject()
+	}
+	if o.Defines != nil || o.raw.Has("defines") {
+		o.raw.Set("defines", o.Defines)
+	}
+	setString(o.raw, "languageVersion", o.LanguageVersion)
+	setString(o.raw, "platform", o.Platform)
+	setString(o.raw, "keyFile", o.KeyFile)
+	setString(o.raw, "debugType", o.DebugType)
+	for _, field := range []struct {
+		key string
+		v   *bool
+	}{
+		{"allowUnsafe", o.AllowUnsafe},
+		{"warningsAsErrors", o.WarningsAsErrors},
+		{"optimize", o.Optimize},
+		{"delaySign", o.DelaySign},
+		{"publicSign", o.PublicSign},
+		{"emitEntryPoint", o.EmitEntryPoint},
+		{"xmlDoc", o.GenerateXMLDocumentation},
+	} {
+		if field.v != nil {
+			o.raw.Set(field.key, *field.v)
+		}
+	}
+	return o.raw.MarshalJSON()
+}
+
+// MarshalJSON 实现json.Marshaler
+func (l *DepsTargetLibrary) MarshalJSON() ([]byte, error) {
+	if l.raw == nil {
+		l.raw = ojson.NewObject()
+	}
+
+	if l.Dependencies != nil {
+		if err := l.raw.Set("dependencies", l.Dependencies); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, kind := range depsAssetKinds {
+		assets := l.Assets[kind]
+		if len(assets) == 0 && !l.raw.Has(string(kind)) {
+			continue
+		}
+
+		object := ojson.NewObject()
+		for _, asset := range assets {
+			if err := object.Set(asset.Path, asset); err != nil {
+				return nil, err
+			}
+		}
+		if err := l.raw.Set(string(kind), object); err != nil {
+			return nil, err
+		}
+	}
+
+	return l.raw.MarshalJSON()
+}
+
+// MarshalJSON 实现json.Marshaler
+func (a *DepsAsset) MarshalJSON() ([]byte, error) {
+	if a.raw == nil {
+		a.raw = ojson.NewObject()
+	}
+	setString(a.raw, "rid", a.Rid)
+	setString(a.raw, "assetType", a.AssetType)
+	setString(a.raw, "locale", a.Locale)
+	setString(a.raw, "assemblyVersion", a.AssemblyVersion)
+	setString(a.raw, "fileVersion", a.FileVersion)
+	return a.raw.MarshalJSON()
+}
+
+// MarshalJSON 实现json.Marshaler
+func (l *DepsLibrary) MarshalJSON() ([]byte, error) {
+	// 新建的library与dotnet sdk一致写入type、serviceable及sha512，解析得到的只写回原本存在或非空的键
+	if l.raw == nil {
+		l.raw = ojson.NewObject()
+		l.raw.Set("type", l.Type)
+		l.raw.Set("serviceable", l.Serviceable)
+		l.raw.Set("sha512", l.Sha512)
+	}
+	setString(l.raw, "type", l.Type)
+	if l.Serviceable || l.raw.Has("serviceable") {
+		l.raw.Set("serviceable", l.Serviceable)
+	}
+	setString(l.raw, "sha512", l.Sha512)
+	setString(l.raw, "path", l.Path)
+	setString(l.raw, "hashPath", l.HashPath)
+	return l.raw.MarshalJSON()
+}
+
+// Target 按名称查找target，不存在时创建
+func (d *DepsJSON) Target(name string) *DepsTarget {
+	for _, target := range d.Targets {
+		if target.Name == name {
+			return target
+		}
+	}
+
+	target := &DepsTarget{
+		Name:      name,
+		Libraries: make([]*DepsTargetLibrary, 0),
+	}
+	d.Targets = append(d.Targets, target)
+
+	return target
+}
+
+// SetLibrary 设置library，已存在时原位替换
+func (d *DepsJSON) SetLibrary(library *DepsLibrary) {
+	for i, lib := range d.Libraries {
+		if lib.Name == library.Name {
+			d.Libraries[i] = library
+			return
+		}
+	}
+	d.Libraries = append(d.Libraries, library)
+}
+
+// Library 按名称查找依赖项，不存在时创建
+func (t *DepsTarget) Library(name string) *DepsTargetLibrary {
+	for _, library := range t.Libraries {
+		if library.Name == name {
+			return library
+		}
+	}
+
+	library := &DepsTargetLibrary{
+		Name:   name,
+		Assets: make(map[DepsAssetKind][]*DepsAsset),
+	}
+	t.Libraries = append(t.Libraries, library)
+
+	return library
+}
+
+// AddAsset 添加文件，同路径的文件原位替换
+func (l *DepsTargetLibrary) AddAsset(kind DepsAssetKind, asset *DepsAsset) {
+	if l.Assets == nil {
+		l.Assets = make(map[DepsAssetKind][]*DepsAsset)
+	}
+	for i, a := range l.Assets[kind] {
+		if a.Path == asset.Path {
+			l.Assets[kind][i] = asset
+			return
+		}
+	}
+	l.Assets[kind] = append(l.Assets[kind], asset)
+}
+
+// RemoveAsset 移除文件
+func (l *DepsTargetLibrary) RemoveAsset(kind DepsAssetKind, path string) {
+	assets := l.Assets[kind]
+	for i, a := range assets {
+		if a.Path == path {
+			l.Assets[kind] = append(assets[:i], assets[i+1:]...)
+			return
+		}
+	}
+}
+
+// PreservesCompilationContext 是否保留了编译上下文（PreserveCompilationContext），运行时编译（如Razor）依赖于此
+func (d *DepsJSON) PreservesCompilationContext() bool {
+	if d.CompilationOptions == nil {
+		return false
+	}
+	for _, target := range d.Targets {
+		for _, library := range target.Libraries {
+			if len(library.Assets[CompileAsset]) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AppBaseCompileReferences DependencyModel只能从<appbase>中解析的编译引用文件名
+// 编译引用依次在<appbase>/refs及<appbase>中查找，referenceassembly（引用包）只在refs存在时可解析
+func (d *DepsJSON) AppBaseCompileReferences(dir string) map[string]bool {
+	references := make(map[string]bool)
+
+	libraryTypes := make(map[string]string)
+	for _, library := range d.Libraries {
+		libraryTypes[library.Name] = library.Type
+	}
+
+	for _, target := range d.Targets {
+		for _, library := range target.Libraries {
+			if libraryTypes[library.Name] == "referenceassembly" {
+				continue
+			}
+			for _, asset := range library.Assets[CompileAsset] {
+				parts := strings.Split(strings.ReplaceAll(asset.Path, "\\", "/"), "/")
+				fileName := parts[len(parts)-1]
+				if !util.PathExists(filepath.Join(dir, "refs", fileName)) {
+					references[fileName] = true
+				}
+			}
+		}
+	}
+
+	return references
+}
@@ -0,0 +1,134 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDepsJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"sdk", `{
+  "runtimeTarget": {
+    "name": ".NETCoreApp,Version=v8.0",
+    "signature": ""
+  },
+  "compilationOptions": {},
+  "targets": {
+    ".NETCoreApp,Version=v8.0": {
+      "App/1.0.0": {
+        "dependencies": {
+          "Newtonsoft.Json": "13.0.3"
+        },
+        "runtime": {
+          "App.dll": {}
+        }
+      },
+      "Newtonsoft.Json/13.0.3": {
+        "runtime": {
+          "lib/net6.0/Newtonsoft.Json.dll": {
+            "assemblyVersion": "13.0.0.0",
+            "fileVersion": "13.0.3.27908"
+          }
+        }
+      }
+    }
+  },
+  "libraries": {
+    "App/1.0.0": {
+      "type": "project",
+      "serviceable": false,
+      "sha512": ""
+    },
+    "Newtonsoft.Json/13.0.3": {
+      "type": "package",
+      "serviceable": true,
+      "sha512": "sha512-xyz",
+      "path": "newtonsoft.json/13.0.3",
+      "hashPath": "newtonsoft.json.13.0.3.nupkg.sha512"
+    }
+  }
+}`},
+		{"no targets", "{\r\n    \"runtimeTarget\": {\r\n        \"name\": \"x\"\r\n    }\r\n}\r\n"},
+		{"library without optional keys", `{
+  "libraries": {
+    "App/1.0.0": {
+      "path": "app"
+    }
+  },
+  "extra": [1, 2]
+}`},
+	}
+
+	for _, test := range tests {
+		depsJSON, err := ParseDepsJSON([]byte(test.data))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		data, err := depsJSON.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		// "extra"中的数组会被重新缩进，其余保持不变
+		want := strings.Replace(test.data, "[1, 2]", "[\n    1,\n    2\n  ]", 1)
+		if string(data) != want {
+			t.Errorf("%s: round trip changed the file:\n%s\n----\n%s", test.name, want, data)
+		}
+	}
+}
+
+func TestDepsJSONNewLibrary(t *testing.T) {
+	depsJSON, err := ParseDepsJSON([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	depsJSON.Target("t").Library("libloader/1.0.0").AddAsset(RuntimeAsset, &DepsAsset{Path: "libloader.dll"})
+	depsJSON.SetLibrary(&DepsLibrary{Name: "libloader/1.0.0", Type: "project"})
+
+	data, _ := depsJSON.Bytes()
+	want := `{
+  "targets": {
+    "t": {
+      "libloader/1.0.0": {
+        "runtime": {
+          "libloader.dll": {}
+        }
+      }
+    }
+  },
+  "libraries": {
+    "libloader/1.0.0": {
+      "type": "project",
+      "serviceable": false,
+      "sha512": ""
+    }
+  }
+}`
+	if string(data) != want {
+		t.Errorf("Bytes =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestDepsJSONInvalid(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{`[]`, "$: expected object, got array"},
+		{`{"targets": []}`, "$.targets: expected object, got array"},
+		{`{"targets": {"t": {"a/1": {"runtime": {"a.dll": {"rid": 1}}}}}}`, `$.targets.t["a/1"].runtime["a.dll"].rid: expected string, got number`},
+		{`{"libraries": {"a/1": {"serviceable": "yes"}}}`, `$.libraries["a/1"].serviceable: expected boolean, got string`},
+	}
+
+	for _, test := range tests {
+		_, err := ParseDepsJSON([]byte(test.data))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("ParseDepsJSON(%s) error = %v, want %s", test.data, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindExeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{"App.exe.config", "Plugin.dll.config", "System.Data.SQLite.dll.config"} {
+		ioutil.WriteFile(filepath.Join(dir, file), []byte("<configuration/>"), 0666)
+	}
+
+	// *.dll.config只通过--fxconfigs显式指定
+	if configs, want := FindExeConfig(dir), []string{filepath.Join(dir, "App.exe.config")}; !reflect.DeepEqual(configs, want) {
+		t.Errorf("FindExeConfig = %v, want %v", configs, want)
+	}
+}
+
+func TestBoundAssemblies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "Plugin.dll.config")
+	ioutil.WriteFile(config, []byte(`<?xml version="1.0" encoding="utf-8"?>
+<configuration>
+  <runtime>
+    <assemblyBinding xmlns="urn:schemas-microsoft-com:asm.v1">
+      <dependentAssembly>
+        <assemblyIdentity name="Foo" culture="neutral"/>
+      </dependentAssembly>
+      <dependentAssembly>
+        <assemblyIdentity name="Foo.resources" culture="de"/>
+      </dependentAssembly>
+    </assemblyBinding>
+    <assemblyBinding xmlns="urn:schemas-microsoft-com:asm.v1">
+      <dependentAssembly>
+        <assemblyIdentity name="Bar"/>
+      </dependentAssembly>
+    </assemblyBinding>
+  </runtime>
+</configuration>`), 0666)
+
+	if bound, want := BoundAssemblies(config), map[string]bool{"Foo.dll": true, "Bar.dll": true}; !reflect.DeepEqual(bound, want) {
+		t.Errorf("BoundAssemblies = %v, want %v", bound, want)
+	}
+}
@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/nulastudio/NetBeauty/src/log"
+	"github.com/nulastudio/NetBeauty/src/pe"
+)
+
+// LoaderAssembly 内置的libloader.dll，用于分析启动钩子的依赖
+var LoaderAssembly []byte
+
+// LoaderDependencies 计算libloader.dll引用的程序集在runtime pack中的闭包，返回文件名
+// FDD时框架程序集不在应用目录中，只返回直接引用
+// 需要在移动文件前计算，结果由FixDeps返回并传给FixRuntimeConfig
+// 旧版本固定保留的System.Memory.dll及System.IO.Packaging.dll不在libloader.dll的引用闭包中，只由LoaderUnknown的回退规则保留
+func LoaderDependencies(dir string, depsJSON *DepsJSON) (map[string]bool, error) {
+	if len(LoaderAssembly) == 0 {
+		return nil, errors.New("libloader.dll not found")
+	}
+
+	metadata, err := pe.ReadMetadata(LoaderAssembly)
+	if err != nil {
+		return nil, fmt.Errorf("invalid libloader.dll: %s", err.Error())
+	}
+
+	runtimePack := make(map[string]bool)
+	if depsJSON != nil {
+		for _, target := range depsJSON.Targets {
+			for _, library := range target.Libraries {
+				if !strings.HasPrefix(library.Name, runtimePackPrefix+NETCoreFramework+".Runtime.") {
+					continue
+				}
+				for _, asset := range library.Assets[RuntimeAsset] {
+					runtimePack[strings.ToLower(filepath.Base(asset.Path))] = true
+				}
+			}
+		}
+	}
+
+	dependencies := make(map[string]bool)
+
+	queue := make([]string, 0)
+	for _, reference := range metadata.References {
+		queue = append(queue, reference.Name)
+	}
+
+	for len(queue) > 0 {
+		fileName := queue[0] + ".dll"
+		queue = queue[1:]
+
+		if dependencies[fileName] {
+			continue
+		}
+		dependencies[fileName] = true
+
+		if !runtimePack[strings.ToLower(fileName)] {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, fileName))
+		if err != nil {
+			continue
+		}
+
+		metadata, err := pe.ReadMetadata(content)
+		if err != nil {
+			continue
+		}
+
+		for _, reference := range metadata.References {
+			queue = append(queue, reference.Name)
+		}
+	}
+
+	names := make([]string, 0, len(dependencies))
+	for name := range dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.LogDetail("Loader Dependencies: " + strings.Join(names, ", "))
+
+	return dependencies, nil
+}
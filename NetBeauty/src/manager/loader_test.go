@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestLoaderDependencies(t *testing.T) {
+	loader, err := ioutil.ReadFile("../libloader/libloader.dll")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(assembly []byte) { LoaderAssembly = assembly }(LoaderAssembly)
+
+	LoaderAssembly = nil
+	if dependencies, err := LoaderDependencies(".", nil); err == nil || dependencies != nil {
+		t.Errorf("LoaderDependencies without libloader.dll = %v, %v", dependencies, err)
+	}
+
+	LoaderAssembly = loader
+
+	// FDD时只有直接引用，System.Memory.dll及System.IO.Packaging.dll不在其中
+	want := map[string]bool{
+		"System.Runtime.dll":                                    true,
+		"System.Runtime.Loader.dll":                             true,
+		"System.Collections.dll":                                true,
+		"System.Runtime.Extensions.dll":                         true,
+		"System.IO.FileSystem.dll":                              true,
+		"System.Runtime.InteropServices.dll":                    true,
+		"System.Runtime.InteropServices.RuntimeInformation.dll": true,
+	}
+
+	dependencies, err := LoaderDependencies(".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dependencies, want) {
+		t.Errorf("LoaderDependencies = %v, want %v", dependencies, want)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/bitly/go-simplejson"
 
 	log "github.com/nulastudio/NetBeauty/src/log"
+	"github.com/nulastudio/NetBeauty/src/pe"
 	"github.com/nulastudio/NetBeauty/src/util"
 )
 
@@ -29,13 +30,15 @@ const (
 )
 
 type analyzedDeps struct {
-	Category   map[string]interface{}
+	Library    *DepsTargetLibrary
+	Kind       DepsAssetKind
 	ItemKey    string
 	Name       string
 	Path       string
 	SecondPath string
 	Type       DepsType
 	Locale     string
+	Rid        string
 }
 
 type Deps struct {
@@ -44,13 +47,15 @@ type Deps struct {
 	SecondPath string
 	Type       DepsType
 	Locale     string
+	Rid        string
 }
 
 type AppHost struct {
-	IsBundle bool
-	Name     string
-	Entry    string
-	Location string
+	IsBundle  bool
+	Name      string
+	Entry     string
+	Location  string
+	Subsystem string
 }
 
 // GitCDN git仓库镜像（默认为github）
@@ -112,6 +117,7 @@ func FindRuntimeConfigJSON(dir string) []string {
 }
 
 // FindExeConfig 寻找指定目录下的*exe.config
+// *.dll.config可能只是程序集自身的设置文件（如System.Data.SQLite.dll.config），只通过--fxconfigs显式指定
 func FindExeConfig(dir string) []string {
 	files, err := filepath.Glob(path.Join(dir, "*exe.config"))
 	if err != nil {
@@ -150,10 +156,11 @@ func FindAppHost(main string, dir string) []string {
 // AnalyzeAppHost 分析AppHost
 func AnalyzeAppHost(main string, appHost string) AppHost {
 	apphost := AppHost{
-		IsBundle: false,
-		Name:     "",
-		Entry:    "",
-		Location: "",
+		IsBundle:  false,
+		Name:      "",
+		Entry:     "",
+		Location:  "",
+		Subsystem: "",
 	}
 
 	binBytes, err := ioutil.ReadFile(appHost)
@@ -173,6 +180,11 @@ func AnalyzeAppHost(main string, appHost string) AppHost {
 
 	apphost.IsBundle = bytes.Contains(binBytes, bundleSignature)
 
+	// 仅Windows apphost（PE）存在子系统
+	if header, err := pe.ReadHeader(binBytes); err == nil {
+		apphost.Subsystem = pe.SubsystemName(header.Subsystem)
+	}
+
 	if false && bytes.Contains(binBytes, defaultEntryBytes) {
 		apphost.Entry = defaultEntry
 	} else {
@@ -231,22 +243,59 @@ func AnalyzeAppHost(main string, appHost string) AppHost {
 	return apphost
 }
 
-// PatchAppHost 修改AppHost入口
-func PatchAppHost(apphost AppHost, entry string) bool {
-	if apphost.Entry == "" {
-		return false
-	}
+// AppHostPatch AppHost的修改内容，为空的字段保持不变
+type AppHostPatch struct {
+	Entry     string
+	Subsystem string
+}
 
+// PatchAppHost 修改AppHost入口及子系统，全部修改完成后重新计算PE校验和并写入
+func PatchAppHost(apphost AppHost, patch AppHostPatch) (entryPatched bool, subsystemPatched bool) {
 	binBytes, err := ioutil.ReadFile(apphost.Location)
 	if err != nil {
 		log.LogError(fmt.Errorf("can not read apphost: %s : %s", apphost.Location, err.Error()), false)
+		return false, false
+	}
+
+	if patch.Subsystem != "" {
+		subsystemPatched = patchAppHostSubsystem(apphost, binBytes, patch.Subsystem)
+	}
+
+	if patch.Entry != "" {
+		entryPatched = patchAppHostEntry(apphost, binBytes, patch.Entry)
+	}
+
+	if !entryPatched && !subsystemPatched {
+		return false, false
+	}
+
+	// 非PE（Linux/macOS）apphost没有校验和
+	if _, err := pe.ReadHeader(binBytes); err == nil {
+		if err := pe.UpdateCheckSum(binBytes); err != nil {
+			log.LogError(fmt.Errorf("invalid apphost: %s : %s", apphost.Location, err.Error()), false)
+			return false, false
+		}
+	}
+
+	if err := ioutil.WriteFile(apphost.Location, binBytes, 0666); err != nil {
+		log.LogError(fmt.Errorf("patch apphost failed: %s : %s", apphost.Location, err.Error()), false)
+		return false, false
+	}
+
+	return entryPatched, subsystemPatched
+}
+
+// patchAppHostEntry 修改AppHost入口
+func patchAppHostEntry(apphost AppHost, binBytes []byte, entry string) bool {
+	if apphost.Entry == "" {
 		return false
 	}
 
 	rawEntryBytes := make([]byte, 1025)
 	copy(rawEntryBytes[1:], apphost.Entry)
 
-	if !bytes.Contains(binBytes, rawEntryBytes) {
+	index := bytes.Index(binBytes, rawEntryBytes)
+	if index == -1 {
 		log.LogError(fmt.Errorf("invalid apphost: %s", apphost.Location), false)
 		return false
 	}
@@ -254,10 +303,26 @@ func PatchAppHost(apphost AppHost, entry string) bool {
 	newEntryBytes := make([]byte, 1025)
 	copy(newEntryBytes[1:], entry)
 
-	binBytes = bytes.Replace(binBytes, rawEntryBytes, newEntryBytes, 1)
+	copy(binBytes[index:], newEntryBytes)
 
-	if err := ioutil.WriteFile(apphost.Location, binBytes, 0666); err != nil {
-		log.LogError(fmt.Errorf("patch apphost failed: %s : %s", apphost.Location, err.Error()), false)
+	return true
+}
+
+// patchAppHostSubsystem 修改AppHost子系统（console/gui）
+func patchAppHostSubsystem(apphost AppHost, binBytes []byte, subsystem string) bool {
+	value, ok := pe.ParseSubsystem(subsystem)
+	if !ok {
+		log.LogError(fmt.Errorf("invalid apphost subsystem: %s", subsystem), false)
+		return false
+	}
+
+	if apphost.Subsystem == "" {
+		log.LogError(fmt.Errorf("apphost is not a PE file, subsystem can not be changed: %s", apphost.Location), false)
+		return false
+	}
+
+	if err := pe.SetSubsystem(binBytes, value); err != nil {
+		log.LogError(fmt.Errorf("invalid apphost: %s : %s", apphost.Location, err.Error()), false)
 		return false
 	}
 
@@ -272,13 +337,16 @@ func AddStartUpHookToDeps(deps string, hook string, version string) bool {
 		return false
 	}
 
-	json, err := simplejson.NewJson(jsonBytes)
+	depsJSON, err := ParseDepsJSON(jsonBytes)
 	if err != nil {
 		log.LogError(fmt.Errorf("invalid deps.json: %s : %s", deps, err.Error()), false)
 		return false
 	}
 
-	runtimeTarget, _ := json.GetPath("runtimeTarget", "name").String()
+	runtimeTarget := ""
+	if depsJSON.RuntimeTarget != nil {
+		runtimeTarget = depsJSON.RuntimeTarget.Name
+	}
 
 	hookEntry := hook
 
@@ -290,24 +358,18 @@ func AddStartUpHookToDeps(deps string, hook string, version string) bool {
 		log.LogDetail("Need Loader Version: No")
 	}
 
-	json.SetPath([]string{
-		"targets",
-		runtimeTarget,
-		hookEntry,
-		"runtime",
-		hook + ".dll",
-	}, make(map[string]interface{}))
-
-	json.SetPath([]string{
-		"libraries",
-		hookEntry,
-	}, map[string]interface{}{
-		"type":        "project",
-		"serviceable": false,
-		"sha512":      "",
+	depsJSON.Target(runtimeTarget).Library(hookEntry).AddAsset(RuntimeAsset, &DepsAsset{
+		Path: hook + ".dll",
+	})
+
+	depsJSON.SetLibrary(&DepsLibrary{
+		Name:        hookEntry,
+		Type:        "project",
+		Serviceable: false,
+		Sha512:      "",
 	})
 
-	jsonBytes, _ = json.EncodePretty()
+	jsonBytes, _ = depsJSON.Bytes()
 	if err := ioutil.WriteFile(deps, jsonBytes, 0666); err != nil {
 		log.LogError(fmt.Errorf("add startup hook to deps.json failed: %s : %s", deps, err.Error()), false)
 		return false
@@ -324,19 +386,15 @@ func AddStartUpHookToRuntimeConfig(runtimeConfig string, hook string) bool {
 		return false
 	}
 
-	json, err := simplejson.NewJson(jsonBytes)
+	runtimeConfigJSON, err := ParseRuntimeConfigJSON(jsonBytes)
 	if err != nil {
 		log.LogError(fmt.Errorf("invalid runtimeconfig.json: %s : %s", runtimeConfig, err.Error()), false)
 		return false
 	}
 
-	json.SetPath([]string{
-		"runtimeOptions",
-		"configProperties",
-		"STARTUP_HOOKS",
-	}, hook)
+	runtimeConfigJSON.Options().SetConfigProperty("STARTUP_HOOKS", hook)
 
-	jsonBytes, _ = json.EncodePretty()
+	jsonBytes, _ = runtimeConfigJSON.Bytes()
 	if err := ioutil.WriteFile(runtimeConfig, jsonBytes, 0666); err != nil {
 		log.LogError(fmt.Errorf("add startup hook to runtimeconfig.json failed: %s : %s", runtimeConfig, err.Error()), false)
 		return false
@@ -345,37 +403,45 @@ func AddStartUpHookToRuntimeConfig(runtimeConfig string, hook string) bool {
 	return true
 }
 
-// FixExeConfig 添加libs到exe.config
-func FixExeConfig(exeConfig string, libsDir string) ([]Deps, bool) {
+// AnalyzeExeConfig 分析exe.config中所有assemblyBinding引用的程序集及目录下的其它程序集
+func AnalyzeExeConfig(exeConfig string) ([]Deps, []Deps, bool) {
 	var allDeps = make([]Deps, 0)
+	// 被--cultures过滤的卫星程序集，冲突检查通过后才删除
+	var filtered = make([]Deps, 0)
 
 	doc := etree.NewDocument()
 	if err := doc.ReadFromFile(exeConfig); err != nil {
 		log.LogError(fmt.Errorf("can not read exe.config: %s : %s", exeConfig, err.Error()), false)
-		return allDeps, false
+		return allDeps, filtered, false
 	}
 
-	assemblyBindings := doc.FindElements("./configuration/runtime/assemblyBinding")
-
-	if len(assemblyBindings) == 0 {
-		return allDeps, true
-	}
-
-	for i, assemblyBinding := range assemblyBindings {
-		assemblyIdentity := assemblyBinding.FindElement("./dependentAssembly/assemblyIdentity")
+	for _, assemblyIdentity := range doc.FindElements("./configuration/runtime/assemblyBinding/dependentAssembly/assemblyIdentity") {
+		dllName := assemblyIdentity.SelectAttrValue("name", "")
 
-		if assemblyIdentity == nil {
+		if dllName == "" {
 			continue
 		}
 
-		dllName := assemblyIdentity.SelectAttrValue("name", "")
-
-		if dllName == "" {
+		// 附属程序集由下方统一处理
+		if culture := assemblyIdentity.SelectAttrValue("culture", ""); culture != "" && !strings.EqualFold(culture, "neutral") {
 			continue
 		}
 
 		dllName += ".dll"
 
+		exists := false
+
+		for _, deps := range allDeps {
+			if dllName == deps.Name {
+				exists = true
+				break
+			}
+		}
+
+		if exists {
+			continue
+		}
+
 		allDeps = append(allDeps, Deps{
 			Name:       dllName,
 			Path:       dllName,
@@ -383,49 +449,6 @@ func FixExeConfig(exeConfig string, libsDir string) ([]Deps, bool) {
 			Type:       Assembly,
 			Locale:     "",
 		})
-
-		if i == 0 {
-			probing := assemblyBinding.SelectElement("probing")
-
-			if probing == nil {
-				probing = assemblyBinding.CreateElement("probing")
-			}
-
-			privatePaths := make([]string, 0)
-
-			privatePathStr := probing.SelectAttrValue("privatePath", "")
-
-			if privatePathStr != "" {
-				privatePaths = append(privatePaths, strings.Split(privatePathStr, ";")...)
-			}
-
-			hasProbing := false
-
-			libsDir = strings.TrimPrefix(libsDir, "./")
-			libsDir = strings.TrimPrefix(libsDir, ".\\")
-
-			for _, privatePath := range privatePaths {
-				if privatePath == libsDir {
-					hasProbing = true
-					break
-				}
-			}
-
-			if !hasProbing {
-				privatePaths = append(privatePaths, libsDir)
-				probing.CreateAttr("privatePath", strings.Join(privatePaths, ";"))
-			}
-		}
-
-		doc.WriteSettings.UseCRLF = true
-
-		doc.Indent(2)
-
-		bytes, _ := doc.WriteToBytes()
-
-		if err := ioutil.WriteFile(exeConfig, bytes, 0666); err != nil {
-			log.LogError(fmt.Errorf("fix exe.config failed: %s : %s", exeConfig, err.Error()), false)
-		}
 	}
 
 	dir := filepath.Dir(exeConfig)
@@ -460,42 +483,226 @@ func FixExeConfig(exeConfig string, libsDir string) ([]Deps, bool) {
 		}
 	}
 
+	// probing privatePath只对托管程序集有效，native必须留在根目录
+	managedDeps := make([]Deps, 0, len(allDeps))
+	for _, deps := range allDeps {
+		depsPath := filepath.Join(dir, deps.Path)
+		if !util.PathExists(depsPath) {
+			managedDeps = append(managedDeps, deps)
+			continue
+		}
+
+		class, reason := classifyDll(depsPath)
+		if class == "managed" {
+			log.LogInfo(fmt.Sprintf("[%s] %s: %s", class, deps.Name, reason))
+			managedDeps = append(managedDeps, deps)
+		} else {
+			log.LogDetail(fmt.Sprintf("[%s] %s: %s, keep in root", class, deps.Name, reason))
+		}
+	}
+	allDeps = managedDeps
+
 	// additional satellite assemblies
 	if sdir, err := util.ReadAllDir(dir); err == nil {
 		for _, d := range sdir {
+			// plugins等目录中的.resources.dll不是卫星程序集
+			if !IsCulture(d) {
+				continue
+			}
 			if files, err := util.ReadAllFile(filepath.Join(dir, d)); err == nil {
 				for _, file := range files {
 					if strings.HasSuffix(file, ".resources.dll") {
-						allDeps = append(allDeps, Deps{
+						satellite := Deps{
 							Name:       file,
 							Path:       d + "/" + file,
 							SecondPath: d + "/" + file,
 							Type:       Resource,
 							Locale:     d,
-						})
+						}
+
+						if filterSatellite(d, file) {
+							filtered = append(filtered, satellite)
+							continue
+						}
+
+						allDeps = append(allDeps, satellite)
 					}
 				}
 			}
 		}
 	}
 
-	return allDeps, true
+	return allDeps, filtered, true
+}
+
+// BoundAssemblies exe.config中assemblyBinding显式声明的程序集文件名（不含附属程序集）
+func BoundAssemblies(exeConfig string) map[string]bool {
+	bound := make(map[string]bool)
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(exeConfig); err != nil {
+		return bound
+	}
+
+	for _, assemblyIdentity := range doc.FindElements("./configuration/runtime/assemblyBinding/dependentAssembly/assemblyIdentity") {
+		dllName := assemblyIdentity.SelectAttrValue("name", "")
+		if culture := assemblyIdentity.SelectAttrValue("culture", ""); dllName == "" || (culture != "" && !strings.EqualFold(culture, "neutral")) {
+			continue
+		}
+		bound[dllName+".dll"] = true
+	}
+
+	return bound
+}
+
+// classifyDll 根据PE头中的CLI头判断dll类型（managed、native或unknown）及原因
+func classifyDll(dll string) (string, string) {
+	content, err := ioutil.ReadFile(dll)
+	if err != nil {
+		return "unknown", err.Error()
+	}
+
+	header, err := pe.ReadHeader(content)
+	if err != nil {
+		return "unknown", err.Error()
+	}
+
+	if !header.IsManaged() {
+		return "native", "no CLI header"
+	}
+
+	return "managed", "CLI header present"
+}
+
+// FixExeConfig 添加libs到exe.config，并将codeBase改写为移动后的路径
+// sharedLibsDirs为同目录下其它配置的libsDir，存放了本配置也引用的程序集
+// relocated为移动前后的相对路径（相对于exe.config所在目录）
+func FixExeConfig(exeConfig string, libsDir string, appLibsDirs []string, sharedLibsDirs []string, relocated map[string]string) bool {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(exeConfig); err != nil {
+		log.LogError(fmt.Errorf("can not read exe.config: %s : %s", exeConfig, err.Error()), false)
+		return false
+	}
+
+	configuration := doc.SelectElement("configuration")
+	if configuration == nil {
+		configuration = doc.CreateElement("configuration")
+	}
+
+	runtime := configuration.SelectElement("runtime")
+	if runtime == nil {
+		runtime = configuration.CreateElement("runtime")
+	}
+
+	assemblyBindings := runtime.SelectElements("assemblyBinding")
+	if len(assemblyBindings) == 0 {
+		assemblyBinding := runtime.CreateElement("assemblyBinding")
+		assemblyBinding.CreateAttr("xmlns", "urn:schemas-microsoft-com:asm.v1")
+		assemblyBindings = append(assemblyBindings, assemblyBinding)
+	}
+
+	libsDir = strings.TrimPrefix(libsDir, "./")
+	libsDir = strings.TrimPrefix(libsDir, ".\\")
+
+	// 只有一个probing会生效，合并所有assemblyBinding中的probing到第一个assemblyBinding中
+	privatePaths := make([]string, 0)
+
+	for _, assemblyBinding := range assemblyBindings {
+		for _, probing := range assemblyBinding.SelectElements("probing") {
+			for _, privatePath := range strings.Split(probing.SelectAttrValue("privatePath", ""), ";") {
+				privatePaths = appendPrivatePath(privatePaths, privatePath)
+			}
+			assemblyBinding.RemoveChild(probing)
+		}
+	}
+
+	// 应用独有的目录优先于共享的libsDir
+	for _, appLibsDir := range appLibsDirs {
+		privatePaths = appendPrivatePath(privatePaths, strings.TrimSuffix(libsDir, "/")+"/"+appLibsDir)
+	}
+	privatePaths = appendPrivatePath(privatePaths, libsDir)
+	for _, sharedLibsDir := range sharedLibsDirs {
+		privatePaths = appendPrivatePath(privatePaths, strings.TrimPrefix(strings.TrimPrefix(sharedLibsDir, "./"), ".\\"))
+	}
+
+	probing := etree.NewElement("probing")
+	probing.CreateAttr("privatePath", strings.Join(privatePaths, ";"))
+	assemblyBindings[0].InsertChildAt(0, probing)
+
+	for _, assemblyBinding := range assemblyBindings {
+		for _, codeBase := range assemblyBinding.FindElements("./dependentAssembly/codeBase") {
+			href := codeBase.SelectAttrValue("href", "")
+			key := strings.TrimPrefix(strings.ReplaceAll(href, "\\", "/"), "./")
+
+			if newPath, ok := relocated[key]; ok {
+				log.LogInfo(fmt.Sprintf("codeBase %s => %s", href, newPath))
+				codeBase.CreateAttr("href", newPath)
+			}
+		}
+	}
+
+	// 主程序及所有托管程序集（移动后的位置）
+	dir := filepath.Dir(exeConfig)
+	assemblies := []string{strings.TrimSuffix(filepath.Base(exeConfig), ".config")}
+	if files, err := util.ReadAllFile(dir); err == nil {
+		for _, file := range files {
+			if strings.HasSuffix(file, ".dll") {
+				assemblies = append(assemblies, file)
+			}
+		}
+	}
+	for _, oldPath := range util.SortedKeys(relocated) {
+		if newPath := relocated[oldPath]; strings.HasSuffix(newPath, ".dll") && !strings.HasSuffix(newPath, ".resources.dll") {
+			assemblies = append(assemblies, newPath)
+		}
+	}
+
+	fixBindingRedirects(dir, assemblies, assemblyBindings)
+
+	doc.WriteSettings.UseCRLF = true
+
+	doc.Indent(2)
+
+	bytes, _ := doc.WriteToBytes()
+
+	if err := ioutil.WriteFile(exeConfig, bytes, 0666); err != nil {
+		log.LogError(fmt.Errorf("fix exe.config failed: %s : %s", exeConfig, err.Error()), false)
+		return false
+	}
+
+	return true
+}
+
+func appendPrivatePath(privatePaths []string, privatePath string) []string {
+	privatePath = strings.TrimSpace(privatePath)
+	if privatePath == "" {
+		return privatePaths
+	}
+	for _, p := range privatePaths {
+		if strings.EqualFold(strings.ReplaceAll(p, "/", "\\"), strings.ReplaceAll(privatePath, "/", "\\")) {
+			return privatePaths
+		}
+	}
+	return append(privatePaths, privatePath)
 }
 
 // FixRuntimeConfig 添加libs到runtimeconfig.json
-func FixRuntimeConfig(runtimeConfig string, libsDir string, subDirs []string, srmMapping map[string]string, sharedRuntimeMode bool, usePatch bool, useWPF bool, rollForward string) bool {
+// loaderDeps为FixDeps计算的loader依赖，为nil时表示无法计算
+func FixRuntimeConfig(runtimeConfig string, libsDir string, appLibsDirs []string, subDirs []string, srmMapping map[string]string, sharedRuntimeMode bool, usePatch bool, traits AppTraits, loaderDeps map[string]bool, rollForward string) bool {
 	jsonBytes, err := ioutil.ReadFile(runtimeConfig)
 	if err != nil {
 		log.LogError(fmt.Errorf("can not read runtimeconfig.json: %s : %s", runtimeConfig, err.Error()), false)
 		return false
 	}
 
-	json, err := simplejson.NewJson(jsonBytes)
+	runtimeConfigJSON, err := ParseRuntimeConfigJSON(jsonBytes)
 	if err != nil {
 		log.LogError(fmt.Errorf("invalid runtimeconfig.json: %s : %s", runtimeConfig, err.Error()), false)
 		return false
 	}
 
+	runtimeOptions := runtimeConfigJSON.Options()
+
 	libsDir = strings.ReplaceAll(libsDir, "\\", "/")
 
 	libsDir = strings.TrimSuffix(libsDir, "/")
@@ -503,17 +710,17 @@ func FixRuntimeConfig(runtimeConfig string, libsDir string, subDirs []string, sr
 	libsDirs := make([]string, 0)
 
 	libsDirs = append(libsDirs, ".")
+	// 应用独有的目录优先于共享的libsDir
+	for _, v := range appLibsDirs {
+		libsDirs = append(libsDirs, libsDir+"/"+v)
+	}
 	libsDirs = append(libsDirs, libsDir)
 
 	for _, v := range subDirs {
 		libsDirs = append(libsDirs, libsDir+"/"+strings.ReplaceAll(v, "\\", "/"))
 	}
 
-	json.SetPath([]string{
-		"runtimeOptions",
-		"configProperties",
-		"NetBeautyLibsDir",
-	}, strings.Join(libsDirs, ";"))
+	runtimeOptions.SetConfigProperty("NetBeautyLibsDir", strings.Join(libsDirs, ";"))
 
 	var appID = ""
 
@@ -523,117 +730,70 @@ func FixRuntimeConfig(runtimeConfig string, libsDir string, subDirs []string, sr
 		entry := strings.Split(fileName, ".runtimeconfig.")[0]
 		appID, _ = util.GetStringMD5(entry)
 
-		json.SetPath([]string{
-			"runtimeOptions",
-			"configProperties",
-			"NetBeautyAppID",
-		}, appID)
+		runtimeOptions.SetConfigProperty("NetBeautyAppID", appID)
 
 		srmMappingArr := make([]string, 0)
-		for fileName, md5 := range srmMapping {
-			srmMappingArr = append(srmMappingArr, fileName+":"+md5)
+		for _, fileName := range util.SortedKeys(srmMapping) {
+			srmMappingArr = append(srmMappingArr, fileName+":"+srmMapping[fileName])
 		}
 		srmMappingStr := strings.Join(srmMappingArr, "|")
-		json.SetPath([]string{
-			"runtimeOptions",
-			"configProperties",
-			"NetBeautySharedRuntimeMode",
-		}, "default")
-		json.SetPath([]string{
-			"runtimeOptions",
-			"configProperties",
-			"NetBeautySharedRuntimeMapping",
-		}, srmMappingStr)
+		runtimeOptions.SetConfigProperty("NetBeautySharedRuntimeMode", "default")
+		runtimeOptions.SetConfigProperty("NetBeautySharedRuntimeMapping", srmMappingStr)
 	} else {
-		json.SetPath([]string{
-			"runtimeOptions",
-			"configProperties",
-			"NetBeautySharedRuntimeMode",
-		}, "no")
+		runtimeOptions.SetConfigProperty("NetBeautySharedRuntimeMode", "no")
 	}
 
 	if usePatch {
-		runtimeOptions := json.Get("runtimeOptions")
-		additionalProbingPaths, ok := runtimeOptions.CheckGet("additionalProbingPaths")
-
-		var existPaths []string = []string{}
-
-		if ok {
-			existPaths, err = additionalProbingPaths.StringArray()
-			if err != nil {
-				log.LogPanic(fmt.Errorf("invalid runtimeconfig.json: %s", err.Error()), 1)
-			}
-		}
-
-		var pathsHashTable map[string]bool = make(map[string]bool, len(existPaths))
-
-		for _, path := range existPaths {
-			pathsHashTable[path] = true
-		}
+		var existPaths []string = runtimeOptions.AdditionalProbingPaths
 
 		var addPaths []string = []string{}
 
 		if !sharedRuntimeMode {
+			for _, v := range appLibsDirs {
+				addPaths = append(addPaths, libsDir+"/"+v)
+			}
 			addPaths = append(addPaths, libsDir)
 		}
 
 		srmNativeDir := libsDir + "/srm_native/" + appID
 
+		conditions := make([]string, 0)
+		if loaderDeps == nil {
+			conditions = append(conditions, ConditionLoaderUnknown)
+		}
+
 		if sharedRuntimeMode {
-			for fileName, md5 := range srmMapping {
+			for _, fileName := range util.SortedKeys(srmMapping) {
+				md5 := srmMapping[fileName]
 				if strings.Contains(fileName, "/") {
-					// // resources
-					// addPaths = append(addPaths, strings.Join([]string{
-					// 	libsDir,
-					// 	"locales",
-					// 	fileName,
-					// 	md5,
-					// }, "/"))
+					// resources: <libsDir>/locales/<slot>/<culture>/<file>，一个应用的卫星程序集只有一个slot
+					addPaths = append(addPaths, strings.Join([]string{
+						libsDir,
+						"locales",
+						md5,
+					}, "/"))
 				} else {
-					if fileName == "System.Collections.dll" ||
-						fileName == "System.Memory.dll" ||
-						fileName == "System.Private.CoreLib.dll" ||
-						fileName == "System.Runtime.dll" ||
-						fileName == "System.Runtime.Extensions.dll" ||
-						fileName == "System.Runtime.InteropServices.dll" ||
-						fileName == "System.Runtime.InteropServices.RuntimeInformation.dll" ||
-						fileName == "System.Runtime.Loader.dll" ||
-						fileName == "System.IO.FileSystem.dll" ||
-						fileName == "System.IO.Packaging.dll" {
+					if loaderDeps[fileName] || KeepRules.Match(SRMScope, fileName, traits, conditions...) != nil {
 						addPaths = append(addPaths, strings.Join([]string{
 							libsDir,
 							fileName,
 							md5,
 						}, "/"))
 					}
-
-					if useWPF {
-						if fileName == "PresentationCore.dll" ||
-							fileName == "PresentationFramework.dll" ||
-							fileName == "WindowsBase.dll" ||
-							fileName == "System.Xaml.dll" {
-							addPaths = append(addPaths, strings.Join([]string{
-								libsDir,
-								fileName,
-								md5,
-							}, "/"))
-						}
-					}
 				}
 			}
 		}
 
-		for _, path := range addPaths {
-			pathsHashTable[path] = true
-		}
+		var pathsHashTable map[string]bool = make(map[string]bool, len(existPaths)+len(addPaths))
 
 		var resultPaths []string = []string{}
 
-		for path := range pathsHashTable {
-			if path == "" {
+		for _, path := range append(existPaths, addPaths...) {
+			if path == "" || pathsHashTable[path] {
 				continue
 			}
 
+			pathsHashTable[path] = true
 			resultPaths = append(resultPaths, path)
 		}
 
@@ -644,17 +804,14 @@ func FixRuntimeConfig(runtimeConfig string, libsDir string, subDirs []string, sr
 			resultPaths = append(resultPaths, libsDir)
 		}
 
-		runtimeOptions.Set("additionalProbingPaths", resultPaths)
+		runtimeOptions.AdditionalProbingPaths = resultPaths
 	}
 
 	if rollForward != "" {
-		json.SetPath([]string{
-			"runtimeOptions",
-			"rollForward",
-		}, rollForward)
+		runtimeOptions.RollForward = rollForward
 	}
 
-	jsonBytes, _ = json.EncodePretty()
+	jsonBytes, _ = runtimeConfigJSON.Bytes()
 	if err := ioutil.WriteFile(runtimeConfig, jsonBytes, 0666); err != nil {
 		log.LogError(fmt.Errorf("add NetBeautyLibsDir to runtimeconfig.json failed: %s : %s", runtimeConfig, err.Error()), false)
 		return false
@@ -663,6 +820,77 @@ func FixRuntimeConfig(runtimeConfig string, libsDir string, subDirs []string, sr
 	return true
 }
 
+// VerifySatelliteProbing 检查deps.json中所有根目录的卫星程序集能否在应用目录或additionalProbingPaths中找到
+func VerifySatelliteProbing(runtimeConfig string) bool {
+	dir := filepath.Dir(runtimeConfig)
+	deps := strings.TrimSuffix(runtimeConfig, ".runtimeconfig.json") + ".deps.json"
+
+	jsonBytes, err := ioutil.ReadFile(runtimeConfig)
+	if err != nil {
+		log.LogError(fmt.Errorf("can not read runtimeconfig.json: %s : %s", runtimeConfig, err.Error()), false)
+		return false
+	}
+
+	runtimeConfigJSON, err := ParseRuntimeConfigJSON(jsonBytes)
+	if err != nil {
+		log.LogError(fmt.Errorf("invalid runtimeconfig.json: %s : %s", runtimeConfig, err.Error()), false)
+		return false
+	}
+
+	jsonBytes, err = ioutil.ReadFile(deps)
+	if err != nil {
+		// 没有deps.json时host只在应用目录查找
+		return true
+	}
+
+	depsJSON, err := ParseDepsJSON(jsonBytes)
+	if err != nil {
+		log.LogError(fmt.Errorf("invalid deps.json: %s : %s", deps, err.Error()), false)
+		return false
+	}
+
+	probingPaths := []string{"."}
+	if runtimeConfigJSON.RuntimeOptions != nil {
+		probingPaths = append(probingPaths, runtimeConfigJSON.RuntimeOptions.AdditionalProbingPaths...)
+	}
+
+	success, count := true, 0
+
+	for _, target := range depsJSON.Targets {
+		for _, library := range target.Libraries {
+			for _, asset := range library.Assets[ResourceAsset] {
+				if !strings.HasPrefix(asset.Path, "./") {
+					continue
+				}
+
+				count++
+
+				found := false
+				for _, probingPath := range probingPaths {
+					if !filepath.IsAbs(probingPath) {
+						probingPath = filepath.Join(dir, probingPath)
+					}
+					if util.PathExists(filepath.Join(probingPath, asset.Path)) {
+						found = true
+						break
+					}
+				}
+
+				if !found {
+					log.LogError(fmt.Errorf("satellite assembly can not be resolved: %s : %s", library.Name, asset.Path), false)
+					success = false
+				}
+			}
+		}
+	}
+
+	if success {
+		log.LogDetail(fmt.Sprintf("satellite probing verified: %d resources", count))
+	}
+
+	return success
+}
+
 // FindFXRVersion 从deps.json中提取出FXR Version
 func FindFXRVersion(deps string) (string, string) {
 	fxrVersion, rid := "", ""
@@ -672,15 +900,15 @@ func FindFXRVersion(deps string) (string, string) {
 		return "", ""
 	}
 
-	json, err := simplejson.NewJson(jsonBytes)
+	depsJSON, err := ParseDepsJSON(jsonBytes)
 	if err != nil {
 		return "", ""
 	}
 
 	// targets
-	targets, _ := json.Get("targets").Map()
-	for _, target := range targets {
-		for targetName := range target.(map[string]interface{}) {
+	for _, target := range depsJSON.Targets {
+		for _, library := range target.Libraries {
+			targetName := library.Name
 			// 解析出fxr信息
 			if !strings.HasPrefix(targetName, "runtime") {
 				continue
@@ -720,117 +948,156 @@ func FindFXRVersion(deps string) (string, string) {
 
 // CheckNeedStartHookVersion 分析deps.json中是否需要添加starthook版本号的依赖项
 func CheckNeedStartHookVersion(deps string) bool {
-	var allAnalyzedDeps = make([]analyzedDeps, 0)
-
 	jsonBytes, err := ioutil.ReadFile(deps)
 	if err != nil {
 		return false
 	}
 
-	json, err := simplejson.NewJson(jsonBytes)
+	depsJSON, err := ParseDepsJSON(jsonBytes)
 	if err != nil {
 		return false
 	}
 
-	targets, _ := json.Get("targets").Map()
-	for _, target := range targets {
-		for _, depsObj := range target.(map[string]interface{}) {
-			runtime := depsObj.(map[string]interface{})["runtime"]
-			if runtime != nil {
-				for filePath := range runtime.(map[string]interface{}) {
-					filePath2 := strings.ReplaceAll(filePath, "\\", "/")
-					parts := strings.Split(filePath2, "/")
-					fileName := parts[len(parts)-1]
-
-					allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
-						Category:   runtime.(map[string]interface{}),
-						ItemKey:    filePath,
-						Name:       fileName,
-						Path:       fileName,
-						SecondPath: fileName,
-						Type:       Assembly,
-						Locale:     "",
-					})
-				}
+	for _, analyzed := range analyzeDeps(depsJSON, "") {
+		if strings.Contains(analyzed.Name, "Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// analyzeDeps 列出deps.json中的所有runtime、resources、native及runtimeTargets文件
+func analyzeDeps(depsJSON *DepsJSON, loaderName string) []analyzedDeps {
+	var allAnalyzedDeps = make([]analyzedDeps, 0)
+
+	for _, target := range depsJSON.Targets {
+		for _, library := range target.Libraries {
+			if loaderName != "" && library.Name == loaderName {
+				continue
 			}
 
-			resources := depsObj.(map[string]interface{})["resources"]
-			if resources != nil {
-				for filePath, locale := range resources.(map[string]interface{}) {
-					filePath2 := strings.ReplaceAll(filePath, "\\", "/")
-					parts := strings.Split(filePath2, "/")
-					fileName := parts[len(parts)-1]
-					culture := locale.(map[string]interface{})["locale"].(string)
-
-					allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
-						Category:   resources.(map[string]interface{}),
-						ItemKey:    filePath,
-						Name:       fileName,
-						Path:       culture + "/" + fileName,
-						SecondPath: culture + "/" + fileName,
-						Type:       Resource,
-						Locale:     culture,
-					})
-				}
+			for _, asset := range library.Assets[RuntimeAsset] {
+				filePath2 := strings.ReplaceAll(asset.Path, "\\", "/")
+				parts := strings.Split(filePath2, "/")
+				fileName := parts[len(parts)-1]
+
+				allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
+					Library:    library,
+					Kind:       RuntimeAsset,
+					ItemKey:    asset.Path,
+					Name:       fileName,
+					Path:       fileName,
+					SecondPath: fileName,
+					Type:       Assembly,
+					Locale:     "",
+				})
 			}
 
-			native := depsObj.(map[string]interface{})["native"]
-			if native != nil {
-				for filePath := range native.(map[string]interface{}) {
-					filePath2 := strings.ReplaceAll(filePath, "\\", "/")
-					parts := strings.Split(filePath2, "/")
-					fileName := parts[len(parts)-1]
-
-					allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
-						Category:   native.(map[string]interface{}),
-						ItemKey:    filePath,
-						Name:       fileName,
-						Path:       fileName,
-						SecondPath: filePath2,
-						Type:       Native,
-						Locale:     "",
-					})
-				}
+			for _, asset := range library.Assets[ResourceAsset] {
+				filePath2 := strings.ReplaceAll(asset.Path, "\\", "/")
+				parts := strings.Split(filePath2, "/")
+				fileName := parts[len(parts)-1]
+				culture := asset.Locale
+
+				allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
+					Library:    library,
+					Kind:       ResourceAsset,
+					ItemKey:    asset.Path,
+					Name:       fileName,
+					Path:       culture + "/" + fileName,
+					SecondPath: culture + "/" + fileName,
+					Type:       Resource,
+					Locale:     culture,
+				})
 			}
-		}
-	}
 
-	for _, analyzed := range allAnalyzedDeps {
-		if strings.Contains(analyzed.Name, "Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation") {
-			return true
+			for _, asset := range library.Assets[NativeAsset] {
+				filePath2 := strings.ReplaceAll(asset.Path, "\\", "/")
+				parts := strings.Split(filePath2, "/")
+				fileName := parts[len(parts)-1]
+
+				allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
+					Library:    library,
+					Kind:       NativeAsset,
+					ItemKey:    asset.Path,
+					Name:       fileName,
+					Path:       fileName,
+					SecondPath: filePath2,
+					Type:       Native,
+					Locale:     "",
+				})
+			}
+
+			// runtimes/<rid>/(lib|native)/...，保留完整路径，运行时由host按RID回退规则选择
+			for _, asset := range library.Assets[RuntimeTargetAsset] {
+				filePath2 := strings.ReplaceAll(asset.Path, "\\", "/")
+				parts := strings.Split(filePath2, "/")
+				fileName := parts[len(parts)-1]
+
+				depsType := Assembly
+				if asset.AssetType == "native" {
+					depsType = Native
+				}
+
+				allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
+					Library:    library,
+					Kind:       RuntimeTargetAsset,
+					ItemKey:    asset.Path,
+					Name:       fileName,
+					Path:       filePath2,
+					SecondPath: filePath2,
+					Type:       depsType,
+					Locale:     "",
+					Rid:        asset.Rid,
+				})
+			}
 		}
 	}
 
-	return false
+	return allAnalyzedDeps
 }
 
-// FixDeps 分析deps.json中的依赖项
-func FixDeps(deps string, entry string, SCDMode bool, noRuntimeInfo bool, usePatch bool, enableDebug bool, sharedRuntimeMode bool, loaderName string) ([]Deps, bool, bool) {
+// FixDeps 分析deps.json中的依赖项，同时返回应用特性及loader依赖（无法计算时为nil）
+// 第四个返回值为被--cultures过滤的卫星程序集，由调用者在冲突检查通过后用RemoveSatellites删除
+func FixDeps(deps string, entry string, SCDMode bool, noRuntimeInfo bool, usePatch bool, enableDebug bool, sharedRuntimeMode bool, loaderName string) ([]Deps, AppTraits, map[string]bool, []Deps) {
+	var traits AppTraits
 	var isAspNetCore = false
 	var useWPF = false
 	var verifyWpfDllSet = false
+	var conditions = make([]string, 0)
 
-	var webConfig = "web.config"
 	var windowsBaseDll = "WindowsBase.dll"
-	var presentationCoreDll = "PresentationCore.dll"
 
-	var allAnalyzedDeps = make([]analyzedDeps, 0)
+	var allAnalyzedDeps []analyzedDeps
 	var allDeps = make([]Deps, 0)
+	var filtered = make([]Deps, 0)
 
 	dir := filepath.Dir(deps)
 
 	jsonBytes, err := ioutil.ReadFile(deps)
 	if err != nil {
 		log.LogError(fmt.Errorf("can not read deps.json: %s : %s", deps, err.Error()), false)
-		return allDeps, useWPF, isAspNetCore
+		return allDeps, traits, nil, filtered
 	}
 
-	json, err := simplejson.NewJson(jsonBytes)
+	depsJSON, err := ParseDepsJSON(jsonBytes)
 	if err != nil {
 		log.LogError(fmt.Errorf("invalid deps.json: %s : %s", deps, err.Error()), false)
-		return allDeps, useWPF, isAspNetCore
+		return allDeps, traits, nil, filtered
 	}
 
+	// 启动钩子依赖的程序集
+	loaderDeps, err := LoaderDependencies(dir, depsJSON)
+	if err != nil {
+		log.LogError(fmt.Errorf("can not analyze loader dependencies: %s", err.Error()), false)
+		conditions = append(conditions, ConditionLoaderUnknown)
+	}
+
+	// 运行时编译时，DependencyModel只在<appbase>/refs及<appbase>中查找编译引用
+	runtimeCompilation := depsJSON.PreservesCompilationContext()
+	compileReferences := depsJSON.AppBaseCompileReferences(dir)
+
 	var shouldSkip = func(fileName string, entry string) bool {
 		// entry point
 		if fileName == entry+".dll" ||
@@ -855,131 +1122,32 @@ func FixDeps(deps string, entry string, SCDMode bool, noRuntimeInfo bool, usePat
 		}
 
 		// Loader dependencies
-		if (SCDMode || noRuntimeInfo) && !usePatch {
-			if fileName == "System.Collections.dll" ||
-				fileName == "System.Memory.dll" ||
-				fileName == "System.Private.CoreLib.dll" ||
-				fileName == "System.Runtime.dll" ||
-				fileName == "System.Runtime.Extensions.dll" ||
-				fileName == "System.Runtime.InteropServices.dll" ||
-				fileName == "System.Runtime.InteropServices.RuntimeInformation.dll" ||
-				fileName == "System.Runtime.Loader.dll" ||
-				fileName == "System.IO.FileSystem.dll" ||
-				fileName == "System.IO.Packaging.dll" ||
-				strings.Contains(fileName, "libSystem.Native") {
-				return true
-			}
-		}
-
-		// ASP.NET Core
-		if isAspNetCore {
-			if strings.Contains(fileName, "aspnetcore") ||
-				strings.Contains(fileName, "aspnetcorev2") {
-				return true
-			}
+		if (SCDMode || noRuntimeInfo) && !usePatch && loaderDeps[fileName] {
+			return true
 		}
 
-		// WPF
-		if !usePatch && useWPF {
-			if fileName == "PresentationFramework.dll" ||
-				fileName == "WindowsBase.dll" ||
-				fileName == "System.Xaml.dll" {
-				return true
-			}
+		// runtime compilation references
+		if runtimeCompilation && compileReferences[fileName] {
+			return true
 		}
 
-		// additional WPF
-		if !usePatch && verifyWpfDllSet {
-			if fileName == "PresentationCore.dll" ||
-				strings.Contains(fileName, "PresentationNative_") ||
-				strings.Contains(fileName, "wpfgfx_") ||
-				strings.Contains(fileName, "vcruntime") ||
-				strings.Contains(fileName, "D3DCompiler_") ||
-				strings.Contains(fileName, "PenImc_") ||
-				strings.Contains(fileName, "PenImc2_") {
-				return true
-			}
+		// ASP.NET Core, WPF
+		if rule := KeepRules.Match(RootScope, fileName, traits, conditions...); rule != nil {
+			log.LogInfo(fmt.Sprintf("keep %s in root: %s", fileName, rule.Name))
+			return true
 		}
 
 		return false
 	}
 
-	targets, _ := json.Get("targets").Map()
-	for _, target := range targets {
-		for depsName, depsObj := range target.(map[string]interface{}) {
-			if depsName == loaderName {
-				continue
-			}
+	allAnalyzedDeps = analyzeDeps(depsJSON, loaderName)
 
-			runtime := depsObj.(map[string]interface{})["runtime"]
-			if runtime != nil {
-				for filePath := range runtime.(map[string]interface{}) {
-					filePath2 := strings.ReplaceAll(filePath, "\\", "/")
-					parts := strings.Split(filePath2, "/")
-					fileName := parts[len(parts)-1]
+	traits = DetectAppTraits(deps, depsJSON)
 
-					if fileName == presentationCoreDll {
-						useWPF = true
-					}
+	isAspNetCore = traits.AspNetCore
+	useWPF = traits.WPF
 
-					allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
-						Category:   runtime.(map[string]interface{}),
-						ItemKey:    filePath,
-						Name:       fileName,
-						Path:       fileName,
-						SecondPath: fileName,
-						Type:       Assembly,
-						Locale:     "",
-					})
-				}
-			}
-
-			resources := depsObj.(map[string]interface{})["resources"]
-			if resources != nil {
-				for filePath, locale := range resources.(map[string]interface{}) {
-					filePath2 := strings.ReplaceAll(filePath, "\\", "/")
-					parts := strings.Split(filePath2, "/")
-					fileName := parts[len(parts)-1]
-					culture := locale.(map[string]interface{})["locale"].(string)
-
-					allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
-						Category:   resources.(map[string]interface{}),
-						ItemKey:    filePath,
-						Name:       fileName,
-						Path:       culture + "/" + fileName,
-						SecondPath: culture + "/" + fileName,
-						Type:       Resource,
-						Locale:     culture,
-					})
-				}
-			}
-
-			native := depsObj.(map[string]interface{})["native"]
-			if native != nil {
-				for filePath := range native.(map[string]interface{}) {
-					filePath2 := strings.ReplaceAll(filePath, "\\", "/")
-					parts := strings.Split(filePath2, "/")
-					fileName := parts[len(parts)-1]
-
-					allAnalyzedDeps = append(allAnalyzedDeps, analyzedDeps{
-						Category:   native.(map[string]interface{}),
-						ItemKey:    filePath,
-						Name:       fileName,
-						Path:       fileName,
-						SecondPath: filePath2,
-						Type:       Native,
-						Locale:     "",
-					})
-				}
-			}
-		}
-	}
-
-	webConfigPath := dir + "/" + webConfig
-
-	if util.PathExists(webConfigPath) {
-		isAspNetCore = true
-	}
+	log.LogDetail("App Traits: " + traits.String())
 
 	if isAspNetCore {
 		log.LogDetail("ASP.NET Core: Yes")
@@ -997,6 +1165,16 @@ func FixDeps(deps string, entry string, SCDMode bool, noRuntimeInfo bool, usePat
 		verifyWpfDllSet = bytes.Index(content, []byte("VerifyWpfDllSet")) != -1
 	}
 
+	if SCDMode || noRuntimeInfo {
+		conditions = append(conditions, ConditionSCD)
+	}
+	if !usePatch {
+		conditions = append(conditions, ConditionNoPatch)
+	}
+	if verifyWpfDllSet {
+		conditions = append(conditions, ConditionVerifyWpfDllSet)
+	}
+
 	if useWPF {
 		log.LogDetail("Use WPF: Yes")
 
@@ -1009,6 +1187,18 @@ func FixDeps(deps string, entry string, SCDMode bool, noRuntimeInfo bool, usePat
 		log.LogDetail("Use WPF: No")
 	}
 
+	if traits.WinForms {
+		log.LogDetail("Use WinForms: Yes")
+	} else {
+		log.LogDetail("Use WinForms: No")
+	}
+
+	if runtimeCompilation {
+		log.LogDetail("Runtime Compilation: Yes")
+	} else {
+		log.LogDetail("Runtime Compilation: No")
+	}
+
 	if enableDebug {
 		log.LogDetail("Enable Debugging: Yes")
 	} else {
@@ -1016,6 +1206,18 @@ func FixDeps(deps string, entry string, SCDMode bool, noRuntimeInfo bool, usePat
 	}
 
 	for _, analyzed := range allAnalyzedDeps {
+		// 不需要的语言
+		if analyzed.Type == Resource && filterSatellite(analyzed.Locale, analyzed.Name) {
+			analyzed.Library.RemoveAsset(analyzed.Kind, analyzed.ItemKey)
+			filtered = append(filtered, Deps{
+				Name:   analyzed.Name,
+				Path:   analyzed.Locale + "/" + analyzed.Name,
+				Type:   Resource,
+				Locale: analyzed.Locale,
+			})
+			continue
+		}
+
 		if shouldSkip(analyzed.Name, entry) {
 			continue
 		}
@@ -1026,14 +1228,20 @@ func FixDeps(deps string, entry string, SCDMode bool, noRuntimeInfo bool, usePat
 			SecondPath: analyzed.SecondPath,
 			Type:       analyzed.Type,
 			Locale:     analyzed.Locale,
+			Rid:        analyzed.Rid,
 		})
 
+		// RID相关文件的路径在移动后由FixRuntimeTargets改写
+		if analyzed.Rid != "" {
+			continue
+		}
+
 		// debug files
 		if !enableDebug {
 			if strings.Contains(analyzed.Name, "mscordaccore") ||
 				strings.Contains(analyzed.Name, "mscordbi") {
 				if !strings.HasPrefix(analyzed.ItemKey, "./") {
-					delete(analyzed.Category, analyzed.ItemKey)
+					analyzed.Library.RemoveAsset(analyzed.Kind, analyzed.ItemKey)
 				}
 				continue
 			}
@@ -1048,53 +1256,42 @@ func FixDeps(deps string, entry string, SCDMode bool, noRuntimeInfo bool, usePat
 					needRooted = true
 				}
 
-				if analyzed.Name == "System.Collections.dll" ||
-					analyzed.Name == "System.Memory.dll" ||
-					analyzed.Name == "System.Private.CoreLib.dll" ||
-					analyzed.Name == "System.Runtime.dll" ||
-					analyzed.Name == "System.Runtime.Extensions.dll" ||
-					analyzed.Name == "System.Runtime.InteropServices.dll" ||
-					analyzed.Name == "System.Runtime.InteropServices.RuntimeInformation.dll" ||
-					analyzed.Name == "System.Runtime.Loader.dll" ||
-					analyzed.Name == "System.IO.FileSystem.dll" ||
-					analyzed.Name == "System.IO.Packaging.dll" {
+				// 卫星程序集由host通过additionalProbingPaths查找
+				if analyzed.Type == Resource {
 					needRooted = true
 				}
 
-				if analyzed.Name == "PresentationCore.dll" || analyzed.Name == "PresentationFramework.dll" ||
-					analyzed.Name == "WindowsBase.dll" ||
-					analyzed.Name == "System.Xaml.dll" {
+				if loaderDeps[analyzed.Name] || KeepRules.Match(SRMScope, analyzed.Name, traits, conditions...) != nil {
 					needRooted = true
 				}
 			}
 
 			if needRooted {
 				if analyzed.Type == Resource {
-					analyzed.Category["./"+analyzed.Locale+"/"+analyzed.Name] = map[string]interface{}{
-						"locale": analyzed.Locale,
-					}
+					analyzed.Library.AddAsset(analyzed.Kind, &DepsAsset{
+						Path:   "./" + analyzed.Locale + "/" + analyzed.Name,
+						Locale: analyzed.Locale,
+					})
 				} else {
-					analyzed.Category["./"+analyzed.Name] = make(map[string]interface{})
+					analyzed.Library.AddAsset(analyzed.Kind, &DepsAsset{
+						Path: "./" + analyzed.Name,
+					})
 				}
 			}
 		}
 
 		if (SCDMode || noRuntimeInfo) && !strings.HasPrefix(analyzed.ItemKey, "./") {
-			delete(analyzed.Category, analyzed.ItemKey)
+			analyzed.Library.RemoveAsset(analyzed.Kind, analyzed.ItemKey)
 		}
 	}
 
 	if usePatch {
-		libraries, _ := json.Get("libraries").Map()
-		for k, lib := range libraries {
-			fixLib := lib.(map[string]interface{})
-			fixLib["path"] = "./"
-			libraries[k] = fixLib
+		for _, library := range depsJSON.Libraries {
+			library.Path = "./"
 		}
-		json.Set("libraries", libraries)
 	}
 
-	jsonBytes, _ = json.EncodePretty()
+	jsonBytes, _ = depsJSON.Bytes()
 	if err := ioutil.WriteFile(deps, jsonBytes, 0666); err != nil {
 		log.LogError(fmt.Errorf("fix deps.json failed: %s : %s", deps, err.Error()), false)
 	}
@@ -1102,23 +1299,76 @@ func FixDeps(deps string, entry string, SCDMode bool, noRuntimeInfo bool, usePat
 	// additional satellite assemblies
 	if sdir, err := util.ReadAllDir(dir); err == nil {
 		for _, d := range sdir {
+			// plugins等目录中的.resources.dll不是卫星程序集
+			if !IsCulture(d) {
+				continue
+			}
 			if files, err := util.ReadAllFile(filepath.Join(dir, d)); err == nil {
 				for _, file := range files {
 					if strings.HasSuffix(file, ".resources.dll") {
-						allDeps = append(allDeps, Deps{
+						satellite := Deps{
 							Name:       file,
 							Path:       d + "/" + file,
 							SecondPath: d + "/" + file,
 							Type:       Resource,
 							Locale:     d,
-						})
+						}
+
+						if filterSatellite(d, file) {
+							filtered = append(filtered, satellite)
+							continue
+						}
+
+						allDeps = append(allDeps, satellite)
 					}
 				}
 			}
 		}
 	}
 
-	return allDeps, useWPF, isAspNetCore
+	return allDeps, traits, loaderDeps, filtered
+}
+
+// FixRuntimeTargets 将已移动的runtimeTargets文件路径改写为移动后的路径
+// relocated为移动前后的相对路径（相对于deps.json所在目录）
+func FixRuntimeTargets(deps string, relocated map[string]string) bool {
+	jsonBytes, err := ioutil.ReadFile(deps)
+	if err != nil {
+		log.LogError(fmt.Errorf("can not read deps.json: %s : %s", deps, err.Error()), false)
+		return false
+	}
+
+	depsJSON, err := ParseDepsJSON(jsonBytes)
+	if err != nil {
+		log.LogError(fmt.Errorf("invalid deps.json: %s : %s", deps, err.Error()), false)
+		return false
+	}
+
+	changed := false
+
+	for _, target := range depsJSON.Targets {
+		for _, library := range target.Libraries {
+			for _, asset := range library.Assets[RuntimeTargetAsset] {
+				if newPath, ok := relocated[strings.ReplaceAll(asset.Path, "\\", "/")]; ok {
+					log.LogInfo(fmt.Sprintf("%s [%s] => %s", asset.Path, asset.Rid, newPath))
+					asset.Path = newPath
+					changed = true
+				}
+			}
+		}
+	}
+
+	if !changed {
+		return true
+	}
+
+	jsonBytes, _ = depsJSON.Bytes()
+	if err := ioutil.WriteFile(deps, jsonBytes, 0666); err != nil {
+		log.LogError(fmt.Errorf("fix runtimeTargets failed: %s : %s", deps, err.Error()), false)
+		return false
+	}
+
+	return true
 }
 
 func onlinePath() string {
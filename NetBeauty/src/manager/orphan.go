@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nulastudio/NetBeauty/src/misc"
+)
+
+// Orphan 根目录中没有被任何deps.json、runtimeconfig.json、apphost、web.config或规则引用的文件
+type Orphan struct {
+	Name string
+	Size int64
+}
+
+// isBinary 只检查dll及native库，其它文件（配置、资源等）由应用自行使用
+func isBinary(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".dll") ||
+		strings.HasSuffix(name, ".so") ||
+		strings.Contains(name, ".so.") ||
+		strings.HasSuffix(name, ".dylib")
+}
+
+// FindOrphans 找出根目录中的孤立文件
+func FindOrphans(dir string, loaderName string) []Orphan {
+	owned := make(map[string]bool)
+
+	var own = func(name string) {
+		owned[strings.ToLower(name)] = true
+	}
+
+	own(loaderName + ".dll")
+
+	for _, deps := range FindDepsJSON(dir) {
+		main := strings.TrimSuffix(filepath.Base(deps), ".deps.json")
+		own(main + ".dll")
+
+		jsonBytes, err := ioutil.ReadFile(deps)
+		if err != nil {
+			continue
+		}
+
+		depsJSON, err := ParseDepsJSON(jsonBytes)
+		if err != nil {
+			continue
+		}
+
+		for _, target := range depsJSON.Targets {
+			for _, library := range target.Libraries {
+				for _, assets := range library.Assets {
+					for _, asset := range assets {
+						own(filepath.Base(strings.ReplaceAll(asset.Path, "\\", "/")))
+					}
+				}
+			}
+		}
+	}
+
+	for _, runtimeConfig := range FindRuntimeConfigJSON(dir) {
+		main := strings.SplitN(filepath.Base(runtimeConfig), ".runtimeconfig", 2)[0]
+		own(main + ".dll")
+	}
+
+	webConfig := ""
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "web.config")); err == nil {
+		webConfig = strings.ToLower(string(content))
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+
+	orphans := make([]Orphan, 0)
+
+	for _, file := range files {
+		name := file.Name()
+
+		if file.IsDir() || !isBinary(name) || owned[strings.ToLower(name)] {
+			continue
+		}
+
+		if webConfig != "" && strings.Contains(webConfig, strings.ToLower(name)) {
+			continue
+		}
+
+		if KeepRules.Mentions(name) {
+			continue
+		}
+
+		orphans = append(orphans, Orphan{Name: name, Size: file.Size()})
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Name < orphans[j].Name
+	})
+
+	return orphans
+}
+
+// MoveOrphan 将孤立文件移动到指定目录，跨设备时复制后删除
+// 隔离的文件不能留在原位置，不使用--link-mode
+func MoveOrphan(dir string, orphan Orphan, target string) error {
+	if err := os.MkdirAll(target, 0777); err != nil {
+		return err
+	}
+	_, err := misc.PlaceFile(filepath.Join(dir, orphan.Name), filepath.Join(target, orphan.Name), misc.MoveMode)
+	return err
+}
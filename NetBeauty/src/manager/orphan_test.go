@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const orphanDepsJSON = `{
+  "runtimeTarget": {"name": ".NETCoreApp,Version=v8.0"},
+  "targets": {
+    ".NETCoreApp,Version=v8.0": {
+      "App/1.0.0": {"runtime": {"App.dll": {}}},
+      "Foo/1.0.0": {
+        "runtime": {"lib/net8.0/Foo.dll": {}},
+        "native": {"runtimes/linux-x64/native/libfoo.so": {}}
+      }
+    }
+  },
+  "libraries": {
+    "App/1.0.0": {"type": "project", "serviceable": false, "sha512": ""},
+    "Foo/1.0.0": {"type": "package", "serviceable": true, "sha512": ""}
+  }
+}`
+
+func TestFindOrphans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"App.deps.json":              orphanDepsJSON,
+		"App.dll":                    "",
+		"Foo.dll":                    "",
+		"libfoo.so":                  "",
+		"Tool.runtimeconfig.json":    "{}",
+		"Tool.dll":                   "",
+		"nbloader.dll":               "",
+		"web.config":                 `<aspNetCore processPath="dotnet" arguments=".\Web.dll" />`,
+		"Web.dll":                    "",
+		"Kept.dll":                   "",
+		"readme.txt":                 "",
+		"Orphan.dll":                 "orphan",
+		"liborphan.so.1":             "",
+		"libx.dylib":                 "",
+		"plugins/Plugin.dll":         "",
+		"runtimes/win/lib/Other.dll": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0777)
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(rules *KeepRuleTable) { KeepRules = rules }(KeepRules)
+	KeepRules = mustParseKeepRules(`{"version": 1, "rules": [{"scope": "root", "requires": ["SCD"], "files": ["Kept.*"]}]}`)
+
+	// 只检查根目录中的dll及native库，deps.json中的资产按文件名归属
+	want := []Orphan{
+		{Name: "Orphan.dll", Size: int64(len("orphan"))},
+		{Name: "liborphan.so.1"},
+		{Name: "libx.dylib"},
+	}
+
+	if orphans := FindOrphans(dir, "nbloader"); !reflect.DeepEqual(orphans, want) {
+		t.Errorf("FindOrphans = %v, want %v", orphans, want)
+	}
+}
@@ -0,0 +1,195 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// razorDepsJSON 与NetBeautyTest/RazorTest发布输出结构相同的deps.json（Razor运行时编译）
+const razorDepsJSON = `{
+  "runtimeTarget": {
+    "name": ".NETCoreApp,Version=v6.0",
+    "signature": ""
+  },
+  "compilationOptions": {
+    "defines": ["TRACE", "RELEASE", "NET", "NET6_0"],
+    "languageVersion": "10.0",
+    "platform": "",
+    "allowUnsafe": false,
+    "warningsAsErrors": false,
+    "optimize": true,
+    "keyFile": "",
+    "emitEntryPoint": true,
+    "xmlDoc": false,
+    "debugType": "portable"
+  },
+  "targets": {
+    ".NETCoreApp,Version=v6.0": {
+      "RazorTest/1.0.0": {
+        "dependencies": {
+          "Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation": "6.0.6",
+          "Microsoft.AspNetCore.Antiforgery": "6.0.0.0"
+        },
+        "runtime": {
+          "RazorTest.dll": {}
+        },
+        "compile": {
+          "RazorTest.dll": {}
+        }
+      },
+      "Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation/6.0.6": {
+        "dependencies": {
+          "Microsoft.CodeAnalysis.Razor": "6.0.6"
+        },
+        "runtime": {
+          "lib/net6.0/Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation.dll": {}
+        },
+        "compile": {
+          "lib/net6.0/Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation.dll": {}
+        }
+      },
+      "Microsoft.CodeAnalysis.Razor/6.0.6": {
+        "runtime": {
+          "lib/netstandard2.0/Microsoft.CodeAnalysis.Razor.dll": {}
+        },
+        "compile": {
+          "lib/netstandard2.0/Microsoft.CodeAnalysis.Razor.dll": {}
+        }
+      },
+      "System.Reflection.Metadata/5.0.0": {
+        "runtime": {
+          "lib/netstandard2.0/System.Reflection.Metadata.dll": {}
+        },
+        "compile": {
+          "ref/netstandard2.0/System.Reflection.Metadata.dll": {}
+        }
+      },
+      "Microsoft.AspNetCore.Antiforgery/6.0.0.0": {
+        "compile": {
+          "Microsoft.AspNetCore.Antiforgery.dll": {}
+        }
+      },
+      "System.Runtime/6.0.0.0": {
+        "compile": {
+          "System.Runtime.dll": {}
+        }
+      },
+      "runtimepack.Microsoft.NETCore.App.Runtime.linux-x64/6.0.6": {
+        "runtime": {
+          "System.Runtime.dll": {
+            "assemblyVersion": "6.0.0.0",
+            "fileVersion": "6.0.622.26707"
+          }
+        }
+      }
+    }
+  },
+  "libraries": {
+    "RazorTest/1.0.0": {
+      "type": "project",
+      "serviceable": false,
+      "sha512": ""
+    },
+    "Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation/6.0.6": {
+      "type": "package",
+      "serviceable": true,
+      "sha512": "sha512-x",
+      "path": "microsoft.aspnetcore.mvc.razor.runtimecompilation/6.0.6",
+      "hashPath": "microsoft.aspnetcore.mvc.razor.runtimecompilation.6.0.6.nupkg.sha512"
+    },
+    "Microsoft.CodeAnalysis.Razor/6.0.6": {
+      "type": "package",
+      "serviceable": true,
+      "sha512": "sha512-x",
+      "path": "microsoft.codeanalysis.razor/6.0.6",
+      "hashPath": "microsoft.codeanalysis.razor.6.0.6.nupkg.sha512"
+    },
+    "System.Reflection.Metadata/5.0.0": {
+      "type": "package",
+      "serviceable": true,
+      "sha512": "sha512-x",
+      "path": "system.reflection.metadata/5.0.0",
+      "hashPath": "system.reflection.metadata.5.0.0.nupkg.sha512"
+    },
+    "Microsoft.AspNetCore.Antiforgery/6.0.0.0": {
+      "type": "referenceassembly",
+      "serviceable": false,
+      "sha512": ""
+    },
+    "System.Runtime/6.0.0.0": {
+      "type": "referenceassembly",
+      "serviceable": false,
+      "sha512": ""
+    },
+    "runtimepack.Microsoft.NETCore.App.Runtime.linux-x64/6.0.6": {
+      "type": "runtimepack",
+      "serviceable": false,
+      "sha512": ""
+    }
+  }
+}`
+
+func TestFixDepsRuntimeCompilation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		"RazorTest.dll",
+		"Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation.dll",
+		"Microsoft.CodeAnalysis.Razor.dll",
+		"System.Reflection.Metadata.dll",
+		"System.Runtime.dll",
+		// PreserveCompilationReferences发布的引用程序集
+		"refs/Microsoft.AspNetCore.Antiforgery.dll",
+		"refs/System.Reflection.Metadata.dll",
+	}
+	for _, file := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0777)
+		if err := ioutil.WriteFile(filepath.Join(dir, file), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deps := filepath.Join(dir, "RazorTest.deps.json")
+	if err := ioutil.WriteFile(deps, []byte(razorDepsJSON), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	allDeps, _, _, _ := FixDeps(deps, "RazorTest", false, false, false, false, false, "nbloader")
+
+	moved := make(map[string]bool)
+	for _, dep := range allDeps {
+		moved[dep.Path] = true
+	}
+
+	tests := []struct {
+		file  string
+		moved bool
+	}{
+		// 编译引用只能从<appbase>解析
+		{"Microsoft.AspNetCore.Mvc.Razor.RuntimeCompilation.dll", false},
+		{"Microsoft.CodeAnalysis.Razor.dll", false},
+		// 编译引用在refs中
+		{"System.Reflection.Metadata.dll", true},
+		// 引用包程序集只从refs解析，同名的实现程序集无需留在<appbase>
+		{"System.Runtime.dll", true},
+		{"RazorTest.dll", false},
+	}
+
+	for _, test := range tests {
+		if moved[test.file] != test.moved {
+			t.Errorf("%s: moved = %v, want %v", test.file, moved[test.file], test.moved)
+		}
+	}
+
+	for path := range moved {
+		if filepath.Dir(filepath.FromSlash(path)) == "refs" {
+			t.Errorf("%s: refs/ must stay in <appbase>", path)
+		}
+	}
+}
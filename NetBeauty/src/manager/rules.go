@@ -0,0 +1,295 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/nulastudio/NetBeauty/src/pe"
+)
+
+// 规则的作用范围
+const (
+	// RootScope 留在根目录，不移动
+	RootScope = "root"
+	// SRMScope SRM模式使用patch时留在根目录，并加入additionalProbingPaths
+	SRMScope = "srm"
+)
+
+// 规则的附加条件，除此之外还可以使用AppTraits中的特性名称（见traitNames）
+const (
+	// ConditionSCD SCD模式或不保留运行时信息
+	ConditionSCD = "SCD"
+	// ConditionNoPatch 未使用patch
+	ConditionNoPatch = "NoPatch"
+	// ConditionVerifyWpfDllSet WindowsBase.dll会校验WPF dll是否位于同一目录
+	ConditionVerifyWpfDllSet = "VerifyWpfDllSet"
+	// ConditionLoaderUnknown 无法读取libloader.dll的引用，回退到规则表中的依赖列表
+	ConditionLoaderUnknown = "LoaderUnknown"
+)
+
+// KeepRule 需要留在根目录的文件规则
+type KeepRule struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+	// Framework 为空时不限制框架
+	Framework string `json:"framework,omitempty"`
+	// MinVersion 框架版本下限（包含），MaxVersion 框架版本上限（不包含）
+	MinVersion string   `json:"minVersion,omitempty"`
+	MaxVersion string   `json:"maxVersion,omitempty"`
+	Requires   []string `json:"requires,omitempty"`
+	// Files 文件名，支持通配符
+	Files []string `json:"files"`
+}
+
+// KeepRuleTable 规则表
+type KeepRuleTable struct {
+	Version int         `json:"version"`
+	Rules   []*KeepRule `json:"rules"`
+}
+
+// KeepRuleTableVersion 内置及用户规则表的格式版本
+const KeepRuleTableVersion = 1
+
+const builtinKeepRules = `{
+	"version": 1,
+	"rules": [
+		{
+			"name": "loader native dependencies",
+			"scope": "root",
+			"requires": ["SCD", "NoPatch"],
+			"files": ["libSystem.Native*"]
+		},
+		{
+			"name": "loader dependencies (fallback)",
+			"scope": "root",
+			"requires": ["SCD", "NoPatch", "LoaderUnknown"],
+			"files": [
+				"System.Collections.dll",
+				"System.Memory.dll",
+				"System.Private.CoreLib.dll",
+				"System.Runtime.dll",
+				"System.Runtime.Extensions.dll",
+				"System.Runtime.InteropServices.dll",
+				"System.Runtime.InteropServices.RuntimeInformation.dll",
+				"System.Runtime.Loader.dll",
+				"System.IO.Packaging.dll"
+			]
+		},
+		{
+			"name": "loader dependencies (fallback)",
+			"scope": "root",
+			"framework": "Microsoft.NETCore.App",
+			"maxVersion": "7.0",
+			"requires": ["SCD", "NoPatch", "LoaderUnknown"],
+			"files": ["System.IO.FileSystem.dll"]
+		},
+		{
+			"name": "loader dependencies (fallback)",
+			"scope": "srm",
+			"requires": ["LoaderUnknown"],
+			"files": [
+				"System.Collections.dll",
+				"System.Memory.dll",
+				"System.Private.CoreLib.dll",
+				"System.Runtime.dll",
+				"System.Runtime.Extensions.dll",
+				"System.Runtime.InteropServices.dll",
+				"System.Runtime.InteropServices.RuntimeInformation.dll",
+				"System.Runtime.Loader.dll",
+				"System.IO.Packaging.dll"
+			]
+		},
+		{
+			"name": "loader dependencies (fallback)",
+			"scope": "srm",
+			"framework": "Microsoft.NETCore.App",
+			"maxVersion": "7.0",
+			"requires": ["LoaderUnknown"],
+			"files": ["System.IO.FileSystem.dll"]
+		},
+		{
+			"name": "ASP.NET Core Module",
+			"scope": "root",
+			"requires": ["AspNetCore"],
+			"files": ["*aspnetcore*"]
+		},
+		{
+			"name": "WPF",
+			"scope": "root",
+			"framework": "Microsoft.WindowsDesktop.App",
+			"requires": ["WPF", "NoPatch"],
+			"files": [
+				"PresentationFramework.dll",
+				"WindowsBase.dll",
+				"System.Xaml.dll"
+			]
+		},
+		{
+			"name": "WPF (VerifyWpfDllSet)",
+			"scope": "root",
+			"framework": "Microsoft.WindowsDesktop.App",
+			"requires": ["VerifyWpfDllSet", "NoPatch"],
+			"files": [
+				"PresentationCore.dll",
+				"*PresentationNative_*",
+				"*wpfgfx_*",
+				"*vcruntime*",
+				"*D3DCompiler_*",
+				"*PenImc_*",
+				"*PenImc2_*"
+			]
+		},
+		{
+			"name": "WPF",
+			"scope": "srm",
+			"framework": "Microsoft.WindowsDesktop.App",
+			"requires": ["WPF"],
+			"files": [
+				"PresentationCore.dll",
+				"PresentationFramework.dll",
+				"WindowsBase.dll",
+				"System.Xaml.dll"
+			]
+		}
+	]
+}`
+
+// conditionNames 所有附加条件
+var conditionNames = []string{ConditionSCD, ConditionNoPatch, ConditionVerifyWpfDllSet, ConditionLoaderUnknown}
+
+// KeepRules 当前使用的规则表
+var KeepRules = mustParseKeepRules(builtinKeepRules)
+
+func mustParseKeepRules(data string) *KeepRuleTable {
+	table, err := parseKeepRules([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+func parseKeepRules(data []byte) (*KeepRuleTable, error) {
+	table := &KeepRuleTable{}
+	if err := json.Unmarshal(data, table); err != nil {
+		return nil, err
+	}
+
+	if table.Version != KeepRuleTableVersion {
+		return nil, fmt.Errorf("unsupported rule table version: %d", table.Version)
+	}
+
+	for i, rule := range table.Rules {
+		if rule.Scope != RootScope && rule.Scope != SRMScope {
+			return nil, fmt.Errorf("rules[%d]: invalid scope: %q", i, rule.Scope)
+		}
+		for _, require := range rule.Requires {
+			if !isKnownRequire(require) {
+				return nil, fmt.Errorf("rules[%d]: unknown requirement: %q", i, require)
+			}
+		}
+		for _, file := range rule.Files {
+			if _, err := filepath.Match(file, ""); err != nil {
+				return nil, fmt.Errorf("rules[%d]: invalid file pattern: %q", i, file)
+			}
+		}
+	}
+
+	return table, nil
+}
+
+func isKnownRequire(require string) bool {
+	for _, name := range append(append([]string{}, conditionNames...), traitNames...) {
+		if require == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadKeepRules 读取用户规则文件并追加到内置规则之后
+func LoadKeepRules(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	table, err := parseKeepRules(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", file, err.Error())
+	}
+
+	KeepRules.Rules = append(KeepRules.Rules, table.Rules...)
+
+	return nil
+}
+
+// Match 查找匹配的规则，conditions为当前成立的附加条件
+func (t *KeepRuleTable) Match(scope string, fileName string, traits AppTraits, conditions ...string) *KeepRule {
+	active := make(map[string]bool)
+	for _, condition := range conditions {
+		active[condition] = true
+	}
+
+	for _, rule := range t.Rules {
+		if rule.Scope != scope || !rule.matchFramework(traits.Frameworks) {
+			continue
+		}
+
+		satisfied := true
+		for _, require := range rule.Requires {
+			if !active[require] && !traits.Has(require) {
+				satisfied = false
+				break
+			}
+		}
+		if !satisfied {
+			continue
+		}
+
+		for _, pattern := range rule.Files {
+			if matched, _ := filepath.Match(pattern, fileName); matched {
+				return rule
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchFramework 框架或版本未知时视为匹配，宁可多留也不要漏留
+func (r *KeepRule) matchFramework(frameworks map[string]string) bool {
+	if r.Framework == "" || len(frameworks) == 0 {
+		return true
+	}
+
+	version, ok := frameworks[r.Framework]
+	if !ok {
+		return false
+	}
+	if version == "" {
+		return true
+	}
+
+	if r.MinVersion != "" && pe.CompareVersion(version, r.MinVersion) < 0 {
+		return false
+	}
+	if r.MaxVersion != "" && pe.CompareVersion(version, r.MaxVersion) >= 0 {
+		return false
+	}
+
+	return true
+}
+
+// Mentions 文件是否被任意规则提及（不考虑条件）
+func (t *KeepRuleTable) Mentions(fileName string) bool {
+	for _, rule := range t.Rules {
+		for _, pattern := range rule.Files {
+			if matched, _ := filepath.Match(pattern, fileName); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKeepRules(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{`{"version": 1, "rules": [{"scope": "root", "requires": ["WPF", "SCD"], "files": ["a.dll"]}]}`, ""},
+		{`{"version": 2, "rules": []}`, "unsupported rule table version: 2"},
+		{`{"version": 1, "rules": [{"scope": "app", "files": ["a.dll"]}]}`, `rules[0]: invalid scope: "app"`},
+		{`{"version": 1, "rules": [{"scope": "root", "files": ["[a.dll"]}]}`, `rules[0]: invalid file pattern: "[a.dll"`},
+		// 显示用的文本不是特性
+		{`{"version": 1, "rules": [{"scope": "root", "requires": ["None"], "files": ["a.dll"]}]}`, `rules[0]: unknown requirement: "None"`},
+		{`{"version": 1, "rules": [{"scope": "root", "requires": ["AspNetCore, WPF"], "files": ["a.dll"]}]}`, `rules[0]: unknown requirement: "AspNetCore, WPF"`},
+	}
+
+	for _, test := range tests {
+		_, err := parseKeepRules([]byte(test.data))
+		if test.err == "" && err != nil {
+			t.Errorf("%s: %s", test.data, err.Error())
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: error = %v, want %s", test.data, err, test.err)
+		}
+	}
+}
+
+func TestBuiltinKeepRules(t *testing.T) {
+	wpf := AppTraits{WindowsDesktop: true, WPF: true, Frameworks: map[string]string{"Microsoft.WindowsDesktop.App": "8.0.0"}}
+	aspNetCore := AppTraits{AspNetCore: true, Frameworks: map[string]string{"Microsoft.AspNetCore.App": "8.0.0"}}
+	net6 := AppTraits{Frameworks: map[string]string{"Microsoft.NETCore.App": "6.0.0"}}
+	net8 := AppTraits{Frameworks: map[string]string{"Microsoft.NETCore.App": "8.0.0"}}
+
+	tests := []struct {
+		scope      string
+		fileName   string
+		traits     AppTraits
+		conditions []string
+		rule       string
+	}{
+		{RootScope, "aspnetcorev2_inprocess.dll", aspNetCore, nil, "ASP.NET Core Module"},
+		{RootScope, "aspnetcorev2_inprocess.dll", AppTraits{}, nil, ""},
+		{RootScope, "WindowsBase.dll", wpf, []string{ConditionNoPatch}, "WPF"},
+		{RootScope, "WindowsBase.dll", wpf, nil, ""},
+		{RootScope, "PresentationCore.dll", wpf, []string{ConditionNoPatch}, ""},
+		{RootScope, "PresentationCore.dll", wpf, []string{ConditionNoPatch, ConditionVerifyWpfDllSet}, "WPF (VerifyWpfDllSet)"},
+		{SRMScope, "PresentationCore.dll", wpf, nil, "WPF"},
+		// WPF规则限定框架
+		{RootScope, "WindowsBase.dll", AppTraits{WPF: true, Frameworks: map[string]string{"Microsoft.NETCore.App": "8.0.0"}}, []string{ConditionNoPatch}, ""},
+		// 版本上限不包含
+		{RootScope, "System.IO.FileSystem.dll", net6, []string{ConditionSCD, ConditionNoPatch, ConditionLoaderUnknown}, "loader dependencies (fallback)"},
+		{RootScope, "System.IO.FileSystem.dll", net8, []string{ConditionSCD, ConditionNoPatch, ConditionLoaderUnknown}, ""},
+		{RootScope, "libSystem.Native.so", net8, []string{ConditionSCD, ConditionNoPatch}, "loader native dependencies"},
+		{RootScope, "App.dll", net8, []string{ConditionSCD, ConditionNoPatch, ConditionLoaderUnknown}, ""},
+	}
+
+	for _, test := range tests {
+		name := ""
+		if rule := KeepRules.Match(test.scope, test.fileName, test.traits, test.conditions...); rule != nil {
+			name = rule.Name
+		}
+		if name != test.rule {
+			t.Errorf("Match(%s, %s, %s, %s) = %q, want %q", test.scope, test.fileName, test.traits, strings.Join(test.conditions, ","), name, test.rule)
+		}
+	}
+}
+
+func TestAppTraitsHas(t *testing.T) {
+	traits := AppTraits{AspNetCore: true, WPF: true}
+
+	for _, name := range traitNames {
+		if traits.Has(name) != (name == TraitAspNetCore || name == TraitWPF) {
+			t.Errorf("Has(%s) = %v", name, traits.Has(name))
+		}
+	}
+	if traits.Has("None") || (AppTraits{}).Has("None") {
+		t.Error(`Has("None") = true`)
+	}
+	if s := traits.String(); s != "AspNetCore, WPF" {
+		t.Errorf("String() = %q", s)
+	}
+}
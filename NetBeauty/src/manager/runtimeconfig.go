@@ -0,0 +1,231 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nulastudio/NetBeauty/src/ojson"
+)
+
+// RuntimeConfigJSON runtimeconfig.json
+type RuntimeConfigJSON struct {
+	RuntimeOptions *RuntimeOptions
+
+	raw    *ojson.Object
+	format ojson.Format
+}
+
+// RuntimeOptions runtimeconfig.json中的runtimeOptions
+type RuntimeOptions struct {
+	Tfm                    string
+	RollForward            string
+	Framework              *RuntimeFramework
+	Frameworks             []*RuntimeFramework
+	IncludedFrameworks     []*RuntimeFramework
+	AdditionalProbingPaths []string
+	ConfigProperties       *ojson.Object
+
+	raw *ojson.Object
+}
+
+// RuntimeFramework runtimeconfig.json中引用的框架
+type RuntimeFramework struct {
+	Name    string
+	Version string
+
+	raw *ojson.Object
+}
+
+// ParseRuntimeConfigJSON 解析runtimeconfig.json
+func ParseRuntimeConfigJSON(data []byte) (*RuntimeConfigJSON, error) {
+	runtimeConfigJSON := &RuntimeConfigJSON{}
+
+	format, err := ojson.Unmarshal(data, runtimeConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimeConfigJSON.format = format
+
+	return runtimeConfigJSON, nil
+}
+
+// Bytes 按原始格式编码runtimeconfig.json
+func (r *RuntimeConfigJSON) Bytes() ([]byte, error) {
+	return ojson.MarshalFormat(r, r.format)
+}
+
+// Options 取runtimeOptions，不存在时创建
+func (r *RuntimeConfigJSON) Options() *RuntimeOptions {
+	if r.RuntimeOptions == nil {
+		r.RuntimeOptions = &RuntimeOptions{}
+	}
+	return r.RuntimeOptions
+}
+
+// AllFrameworks 所有引用的框架（framework、frameworks及includedFrameworks）
+func (r *RuntimeConfigJSON) AllFrameworks() []*RuntimeFramework {
+	frameworks := make([]*RuntimeFramework, 0)
+
+	if r.RuntimeOptions == nil {
+		return frameworks
+	}
+
+	if r.RuntimeOptions.Framework != nil {
+		frameworks = append(frameworks, r.RuntimeOptions.Framework)
+	}
+	frameworks = append(frameworks, r.RuntimeOptions.Frameworks...)
+	frameworks = append(frameworks, r.RuntimeOptions.IncludedFrameworks...)
+
+	return frameworks
+}
+
+// SetConfigProperty 设置configProperties
+func (o *RuntimeOptions) SetConfigProperty(key string, value interface{}) {
+	if o.ConfigProperties == nil {
+		o.ConfigProperties = ojson.NewObject()
+	}
+	o.ConfigProperties.Set(key, value)
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，遇到不符合结构的节点时返回第一个错误
+func (r *RuntimeConfigJSON) UnmarshalJSON(data []byte) error {
+	dec := &schemaDecoder{}
+	r.decode(dec, data)
+	return dec.err()
+}
+
+// decode 按runtimeconfig.json结构解码，不符合结构的节点记录到dec中并跳过
+func (r *RuntimeConfigJSON) decode(dec *schemaDecoder, data []byte) {
+	r.raw = ojson.NewObject()
+	r.format = ojson.DefaultFormat
+
+	root := dec.object(data, "$")
+	if root == nil {
+		return
+	}
+	r.raw = root
+
+	path := "$.runtimeOptions"
+
+	object := dec.memberObject(root, "runtimeOptions", "$")
+	if object == nil {
+		return
+	}
+
+	options := &RuntimeOptions{raw: object}
+
+	dec.str(object, "tfm", path, &options.Tfm, false)
+	dec.str(object, "rollForward", path, &options.RollForward, false)
+
+	if framework := dec.memberObject(object, "framework", path); framework != nil {
+		options.Framework = decodeFramework(dec, framework, jsonPath(path, "framework"))
+	}
+
+	for _, field := range []struct {
+		key string
+		v   *[]*RuntimeFramework
+	}{
+		{"frameworks", &options.Frameworks},
+		{"includedFrameworks", &options.IncludedFrameworks},
+	} {
+		raw := object.Raw(field.key)
+		if raw == nil {
+			continue
+		}
+
+		fieldPath := jsonPath(path, field.key)
+
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			dec.report(fieldPath, "array", ojson.Kind(raw))
+			continue
+		}
+
+		*field.v = make([]*RuntimeFramework, 0)
+		for i, item := range items {
+			itemPath := fmt.Sprintf("%s[%d]", fieldPath, i)
+			if framework := dec.object(item, itemPath); framework != nil {
+				*field.v = append(*field.v, decodeFramework(dec, framework, itemPath))
+			}
+		}
+	}
+
+	dec.strings(object, "additionalProbingPaths", path, &options.AdditionalProbingPaths)
+
+	options.ConfigProperties = dec.memberObject(object, "configProperties", path)
+
+	r.RuntimeOptions = options
+}
+
+func decodeFramework(dec *schemaDecoder, object *ojson.Object, path string) *RuntimeFramework {
+	framework := &RuntimeFramework{raw: object}
+
+	dec.str(object, "name", path, &framework.Name, true)
+	dec.str(object, "version", path, &framework.Version, false)
+
+	return framework
+}
+
+// MarshalJSON 实现json.Marshaler
+func (r *RuntimeConfigJSON) MarshalJSON() ([]byte, error) {
+	if r.raw == nil {
+		r.raw = ojson.NewObject()
+	}
+
+	if r.RuntimeOptions != nil {
+		if err := r.raw.Set("runtimeOptions", r.RuntimeOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.raw.MarshalJSON()
+}
+
+// MarshalJSON 实现json.Marshaler
+func (o *RuntimeOptions) MarshalJSON() ([]byte, error) {
+	if o.raw == nil {
+		o.raw = ojson.NewObject()
+	}
+
+	setString(o.raw, "tfm", o.Tfm)
+	setString(o.raw, "rollForward", o.RollForward)
+
+	if o.Framework != nil {
+		if err := o.raw.Set("framework", o.Framework); err != nil {
+			return nil, err
+		}
+	}
+	if o.Frameworks != nil || o.raw.Has("frameworks") {
+		if err := o.raw.Set("frameworks", o.Frameworks); err != nil {
+			return nil, err
+		}
+	}
+	if o.IncludedFrameworks != nil || o.raw.Has("includedFrameworks") {
+		if err := o.raw.Set("includedFrameworks", o.IncludedFrameworks); err != nil {
+			return nil, err
+		}
+	}
+	if o.AdditionalProbingPaths != nil || o.raw.Has("additionalProbingPaths") {
+		if err := o.raw.Set("additionalProbingPaths", o.AdditionalProbingPaths); err != nil {
+			return nil, err
+		}
+	}
+	if o.ConfigProperties != nil {
+		if err := o.raw.Set("configProperties", o.ConfigProperties); err != nil {
+			return nil, err
+		}
+	}
+
+	return o.raw.MarshalJSON()
+}
+
+// MarshalJSON 实现json.Marshaler
+func (f *RuntimeFramework) MarshalJSON() ([]byte, error) {
+	if f.raw == nil {
+		f.raw = ojson.NewObject()
+	}
+	f.raw.Set("name", f.Name)
+	setString(f.raw, "version", f.Version)
+	return f.raw.MarshalJSON()
+}
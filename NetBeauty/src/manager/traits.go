@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/nulastudio/NetBeauty/src/pe"
+	"github.com/nulastudio/NetBeauty/src/util"
+)
+
+// 共享框架名称
+const (
+	NETCoreFramework        = "Microsoft.NETCore.App"
+	AspNetCoreFramework     = "Microsoft.AspNetCore.App"
+	WindowsDesktopFramework = "Microsoft.WindowsDesktop.App"
+)
+
+// runtimePackPrefix SCD时deps.json中runtime pack的library名称前缀：runtimepack.<框架>.Runtime.<rid>
+const runtimePackPrefix = "runtimepack."
+
+// AppTraits 应用使用的框架及UI技术
+type AppTraits struct {
+	AspNetCore     bool
+	WindowsDesktop bool
+	WPF            bool
+	WinForms       bool
+
+	// Frameworks 引用的框架及版本，版本未知时为空
+	Frameworks map[string]string
+}
+
+// 特性名称，可在规则的requires中使用
+const (
+	TraitAspNetCore     = "AspNetCore"
+	TraitWindowsDesktop = "WindowsDesktop"
+	TraitWPF            = "WPF"
+	TraitWinForms       = "WinForms"
+)
+
+// traitNames 所有特性名称
+var traitNames = []string{TraitAspNetCore, TraitWindowsDesktop, TraitWPF, TraitWinForms}
+
+// Has 是否具有指定名称的特性
+func (t AppTraits) Has(name string) bool {
+	switch name {
+	case TraitAspNetCore:
+		return t.AspNetCore
+	case TraitWindowsDesktop:
+		return t.WindowsDesktop
+	case TraitWPF:
+		return t.WPF
+	case TraitWinForms:
+		return t.WinForms
+	}
+	return false
+}
+
+// String 逗号分隔的特性列表，仅用于显示
+func (t AppTraits) String() string {
+	traits := make([]string, 0)
+	for _, name := range traitNames {
+		if t.Has(name) {
+			traits = append(traits, name)
+		}
+	}
+	if len(traits) == 0 {
+		return "None"
+	}
+	return strings.Join(traits, ", ")
+}
+
+// 引用这些程序集即视为使用了WPF或WinForms
+var wpfAssemblies = []string{"PresentationFramework", "PresentationCore", "WindowsBase", "System.Xaml", "WindowsFormsIntegration"}
+var winFormsAssemblies = []string{"System.Windows.Forms"}
+
+// DetectAppTraits 根据runtimeconfig.json中的frameworks/includedFrameworks、deps.json中的runtime pack及应用程序集的引用识别应用特性
+func DetectAppTraits(deps string, depsJSON *DepsJSON) AppTraits {
+	traits := AppTraits{Frameworks: make(map[string]string)}
+
+	dir := filepath.Dir(deps)
+
+	runtimeConfig := strings.TrimSuffix(deps, ".deps.json") + ".runtimeconfig.json"
+	if content, err := ioutil.ReadFile(runtimeConfig); err == nil {
+		if runtimeConfigJSON, err := ParseRuntimeConfigJSON(content); err == nil {
+			for _, framework := range runtimeConfigJSON.AllFrameworks() {
+				traits.Frameworks[framework.Name] = framework.Version
+			}
+		}
+	}
+
+	for _, target := range depsJSON.Targets {
+		for _, library := range target.Libraries {
+			if !strings.HasPrefix(library.Name, runtimePackPrefix) {
+				continue
+			}
+
+			// runtimepack.Microsoft.NETCore.App.Runtime.win-x64/6.0.0
+			name := strings.SplitN(strings.TrimPrefix(library.Name, runtimePackPrefix), ".Runtime.", 2)[0]
+			version := ""
+			if i := strings.LastIndex(library.Name, "/"); i != -1 {
+				version = library.Name[i+1:]
+			}
+			traits.Frameworks[name] = version
+		}
+	}
+
+	// 其它共享框架均依赖于与其版本一致的Microsoft.NETCore.App
+	if _, ok := traits.Frameworks[NETCoreFramework]; !ok {
+		for _, version := range traits.Frameworks {
+			traits.Frameworks[NETCoreFramework] = version
+			break
+		}
+	}
+
+	_, traits.AspNetCore = traits.Frameworks[AspNetCoreFramework]
+	_, traits.WindowsDesktop = traits.Frameworks[WindowsDesktopFramework]
+
+	// 通过IIS托管的应用
+	if util.PathExists(filepath.Join(dir, "web.config")) {
+		traits.AspNetCore = true
+	}
+
+	if !traits.WindowsDesktop {
+		return traits
+	}
+
+	// WindowsDesktop同时包含WPF及WinForms，需要根据应用自身程序集的引用区分
+	analyzed := false
+
+	for _, target := range depsJSON.Targets {
+		for _, library := range target.Libraries {
+			if strings.HasPrefix(library.Name, runtimePackPrefix) {
+				continue
+			}
+
+			for _, asset := range library.Assets[RuntimeAsset] {
+				parts := strings.Split(strings.ReplaceAll(asset.Path, "\\", "/"), "/")
+
+				content, err := ioutil.ReadFile(filepath.Join(dir, parts[len(parts)-1]))
+				if err != nil {
+					continue
+				}
+
+				metadata, err := pe.ReadMetadata(content)
+				if err != nil {
+					continue
+				}
+
+				analyzed = true
+
+				for _, reference := range metadata.References {
+					if containsFold(wpfAssemblies, reference.Name) {
+						traits.WPF = true
+					}
+					if containsFold(winFormsAssemblies, reference.Name) {
+						traits.WinForms = true
+					}
+				}
+			}
+		}
+	}
+
+	// 无法读取应用程序集时，沿用文件存在性判断
+	if !analyzed {
+		traits.WPF = util.PathExists(filepath.Join(dir, "PresentationCore.dll"))
+		traits.WinForms = util.PathExists(filepath.Join(dir, "System.Windows.Forms.dll"))
+	}
+
+	return traits
+}
+
+func containsFold(arr []string, v string) bool {
+	for _, c := range arr {
+		if strings.EqualFold(c, v) {
+			return true
+		}
+	}
+	return false
+}
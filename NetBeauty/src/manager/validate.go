@@ -0,0 +1,186 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/nulastudio/NetBeauty/src/ojson"
+)
+
+// JSONDiagnostic deps.json/runtimeconfig.json中不符合预期结构的节点
+type JSONDiagnostic struct {
+	File     string
+	Path     string
+	Expected string
+	Got      string
+}
+
+func (d JSONDiagnostic) String() string {
+	return fmt.Sprintf("%s: %s: expected %s, got %s", d.File, d.Path, d.Expected, d.Got)
+}
+
+// schemaDecoder 按结构解码deps.json/runtimeconfig.json时收集不符合预期的节点
+// 解码与校验共用同一份结构定义，解码遇到错误的节点时跳过并继续
+type schemaDecoder struct {
+	file        string
+	diagnostics []JSONDiagnostic
+}
+
+func (dec *schemaDecoder) report(path string, expected string, got string) {
+	dec.diagnostics = append(dec.diagnostics, JSONDiagnostic{
+		File:     dec.file,
+		Path:     path,
+		Expected: expected,
+		Got:      got,
+	})
+}
+
+// err 第一个不符合预期的节点
+func (dec *schemaDecoder) err() error {
+	if len(dec.diagnostics) == 0 {
+		return nil
+	}
+	d := dec.diagnostics[0]
+	return fmt.Errorf("%s: expected %s, got %s", d.Path, d.Expected, d.Got)
+}
+
+// object 解码对象，不是对象时返回nil
+func (dec *schemaDecoder) object(raw json.RawMessage, path string) *ojson.Object {
+	object := ojson.NewObject()
+	if json.Unmarshal(raw, object) != nil {
+		dec.report(path, "object", ojson.Kind(raw))
+		return nil
+	}
+	return object
+}
+
+// memberObject 解码可选的对象成员，不存在或不是对象时返回nil
+func (dec *schemaDecoder) memberObject(object *ojson.Object, key string, path string) *ojson.Object {
+	raw := object.Raw(key)
+	if raw == nil {
+		return nil
+	}
+	return dec.object(raw, jsonPath(path, key))
+}
+
+// str 解码字符串成员，required为true时成员必须存在
+func (dec *schemaDecoder) str(object *ojson.Object, key string, path string, v *string, required bool) bool {
+	raw := object.Raw(key)
+	if raw == nil {
+		if required {
+			dec.report(jsonPath(path, key), "string", "missing")
+		}
+		return false
+	}
+	if json.Unmarshal(raw, v) != nil || ojson.Kind(raw) != "string" {
+		dec.report(jsonPath(path, key), "string", ojson.Kind(raw))
+		return false
+	}
+	return true
+}
+
+// boolean 解码可选的布尔成员
+func (dec *schemaDecoder) boolean(object *ojson.Object, key string, path string, v *bool) bool {
+	raw := object.Raw(key)
+	if raw == nil {
+		return false
+	}
+	if json.Unmarshal(raw, v) != nil || ojson.Kind(raw) != "boolean" {
+		dec.report(jsonPath(path, key), "boolean", ojson.Kind(raw))
+		return false
+	}
+	return true
+}
+
+// strings 解码可选的字符串数组成员，跳过不是字符串的元素
+func (dec *schemaDecoder) strings(object *ojson.Object, key string, path string, v *[]string) {
+	raw := object.Raw(key)
+	if raw == nil {
+		return
+	}
+
+	path = jsonPath(path, key)
+
+	var items []json.RawMessage
+	if json.Unmarshal(raw, &items) != nil || items == nil {
+		dec.report(path, "array", ojson.Kind(raw))
+		return
+	}
+
+	*v = make([]string, 0, len(items))
+	for i, item := range items {
+		var value string
+		if json.Unmarshal(item, &value) != nil || ojson.Kind(item) != "string" {
+			dec.report(fmt.Sprintf("%s[%d]", path, i), "string", ojson.Kind(item))
+			continue
+		}
+		*v = append(*v, value)
+	}
+}
+
+// syntax 校验JSON语法，返回去除BOM后的内容
+func (dec *schemaDecoder) syntax(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf})
+
+	var raw json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		got := err.Error()
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line, column := lineColumn(data, syntaxErr.Offset)
+			got = fmt.Sprintf("%s at line %d, column %d", syntaxErr.Error(), line, column)
+		}
+		dec.report("$", "valid JSON", got)
+		return nil
+	}
+
+	return data
+}
+
+// lineColumn 出错字符所在的行列，SyntaxError.Offset为读取出错字符之后的偏移
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset > 0 {
+		offset--
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// ValidateDepsJSON 校验deps.json结构，返回所有不符合预期的节点
+func ValidateDepsJSON(deps string) []JSONDiagnostic {
+	dec := &schemaDecoder{file: deps, diagnostics: make([]JSONDiagnostic, 0)}
+
+	if data := dec.read(deps); data != nil {
+		(&DepsJSON{}).decode(dec, data)
+	}
+
+	return dec.diagnostics
+}
+
+// ValidateRuntimeConfigJSON 校验runtimeconfig.json结构，返回所有不符合预期的节点
+func ValidateRuntimeConfigJSON(runtimeConfig string) []JSONDiagnostic {
+	dec := &schemaDecoder{file: runtimeConfig, diagnostics: make([]JSONDiagnostic, 0)}
+
+	if data := dec.read(runtimeConfig); data != nil {
+		(&RuntimeConfigJSON{}).decode(dec, data)
+	}
+
+	return dec.diagnostics
+}
+
+// read 读取文件并校验JSON语法
+func (dec *schemaDecoder) read(file string) []byte {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		dec.report("$", "readable file", err.Error())
+		return nil
+	}
+
+	return dec.syntax(data)
+}
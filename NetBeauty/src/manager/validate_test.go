@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTemp(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func diagnosticPaths(diagnostics []JSONDiagnostic) []string {
+	paths := make([]string, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		paths = append(paths, d.Path+": "+d.Expected+", "+d.Got)
+	}
+	return paths
+}
+
+func TestValidateDepsJSON(t *testing.T) {
+	file := writeTemp(t, "App.deps.json", `{
+  "runtimeTarget": { "signature": "" },
+  "compilationOptions": { "defines": ["TRACE", 1], "optimize": null },
+  "targets": {
+    "t": {
+      "a/1": {
+        "dependencies": { "b": 1 },
+        "runtimeTargets": {
+          "runtimes/win/native/a.dll": { "rid": "win", "assetType": "resource" },
+          "runtimes/linux/native/a.so": { "assetType": "native" }
+        },
+        "resources": {
+          "de/a.resources.dll": {}
+        }
+      },
+      "b/1": []
+    }
+  },
+  "libraries": {
+    "a/1": { "type": 1, "serviceable": "yes" }
+  }
+}`)
+
+	want := []string{
+		`$.runtimeTarget.name: string, missing`,
+		`$.compilationOptions.defines[1]: string, number`,
+		`$.targets.t["a/1"].dependencies.b: string, number`,
+		`$.targets.t["a/1"].runtimeTargets["runtimes/win/native/a.dll"].assetType: "runtime" or "native", "resource"`,
+		`$.targets.t["a/1"].runtimeTargets["runtimes/linux/native/a.so"].rid: string, missing`,
+		`$.targets.t["a/1"].resources["de/a.resources.dll"].locale: string, missing`,
+		`$.targets.t["b/1"]: object, array`,
+		`$.libraries["a/1"].type: string, number`,
+		`$.libraries["a/1"].serviceable: boolean, string`,
+	}
+
+	got := diagnosticPaths(ValidateDepsJSON(file))
+	if len(got) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d:\n%q", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("diagnostic %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	// 解析时返回第一个错误
+	data, _ := ioutil.ReadFile(file)
+	if _, err := ParseDepsJSON(data); err == nil || err.Error() != "$.runtimeTarget.name: expected string, got missing" {
+		t.Errorf("ParseDepsJSON error = %v", err)
+	}
+}
+
+func TestValidateRuntimeConfigJSON(t *testing.T) {
+	file := writeTemp(t, "App.runtimeconfig.json", `{
+  "runtimeOptions": {
+    "tfm": "net8.0",
+    "frameworks": [ { "version": "8.0.0" }, "Microsoft.NETCore.App" ],
+    "additionalProbingPaths": "libraries"
+  }
+}`)
+
+	want := []string{
+		`$.runtimeOptions.frameworks[0].name: string, missing`,
+		`$.runtimeOptions.frameworks[1]: object, string`,
+		`$.runtimeOptions.additionalProbingPaths: array, string`,
+	}
+
+	got := diagnosticPaths(ValidateRuntimeConfigJSON(file))
+	if len(got) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d:\n%q", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("diagnostic %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestValidateSyntax(t *testing.T) {
+	file := writeTemp(t, "App.deps.json", "\xef\xbb\xbf{\n  \"targets\": {,\n}")
+
+	diagnostics := ValidateDepsJSON(file)
+	if len(diagnostics) != 1 {
+		t.Fatalf("got %d diagnostics, want 1", len(diagnostics))
+	}
+	if want := "invalid character ',' looking for beginning of object key string at line 2, column 15"; diagnostics[0].Got != want {
+		t.Errorf("Got = %q, want %q", diagnostics[0].Got, want)
+	}
+}
@@ -0,0 +1,220 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+
+	log "github.com/nulastudio/NetBeauty/src/log"
+	"github.com/nulastudio/NetBeauty/src/util"
+)
+
+// FixWebConfig 改写web.config中aspNetCore的processPath及arguments，使其指向移动后的apphost及入口dll
+// appHost为移动后apphost的完整路径（不存在apphost时为空），entryDll为入口dll的完整路径
+func FixWebConfig(webConfig string, main string, appHost string, entryDll string) bool {
+	content, err := ioutil.ReadFile(webConfig)
+	if err != nil {
+		log.LogError(fmt.Errorf("can not read web.config: %s : %s", webConfig, err.Error()), false)
+		return false
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(content); err != nil {
+		log.LogError(fmt.Errorf("invalid web.config: %s : %s", webConfig, err.Error()), false)
+		return false
+	}
+
+	webDir := filepath.Dir(webConfig)
+
+	// 只替换属性值，保留原文件的格式
+	tags := aspNetCoreTags(content)
+	elements := doc.FindElements("//aspNetCore")
+	if len(tags) != len(elements) {
+		log.LogError(fmt.Errorf("can not locate aspNetCore elements in web.config: %s", webConfig), false)
+		return false
+	}
+
+	newContent := make([]byte, 0, len(content))
+	last := 0
+
+	for i, aspNetCore := range elements {
+		processPath := aspNetCore.SelectAttrValue("processPath", "")
+		processName := strings.ToLower(filepath.Base(strings.ReplaceAll(processPath, "\\", "/")))
+
+		tag := content[tags[i][0]:tags[i][1]]
+
+		switch {
+		case processName == "dotnet" || processName == "dotnet.exe":
+			// framework-dependent：dotnet <entry.dll> [args]
+			if entryDll == "" {
+				break
+			}
+
+			arguments := aspNetCore.SelectAttrValue("arguments", "")
+			entry, rest := splitFirstArgument(arguments)
+
+			if !strings.EqualFold(filepath.Base(strings.ReplaceAll(entry, "\\", "/")), main+".dll") {
+				break
+			}
+
+			newArguments := quoteArgument(webRelativePath(webDir, entryDll)) + rest
+			if newArguments != arguments {
+				log.LogDetail(fmt.Sprintf("web.config arguments: %s => %s", arguments, newArguments))
+				tag = replaceAttr(tag, "arguments", newArguments)
+			}
+		case processName == strings.ToLower(main) || processName == strings.ToLower(main)+".exe":
+			// apphost
+			if appHost == "" {
+				break
+			}
+
+			newProcessPath := webRelativePath(webDir, appHost)
+			if newProcessPath != processPath {
+				log.LogDetail(fmt.Sprintf("web.config processPath: %s => %s", processPath, newProcessPath))
+				tag = replaceAttr(tag, "processPath", newProcessPath)
+			}
+		}
+
+		newContent = append(append(newContent, content[last:tags[i][0]]...), tag...)
+		last = tags[i][1]
+	}
+
+	newContent = append(newContent, content[last:]...)
+
+	if bytes.Equal(newContent, content) {
+		return true
+	}
+
+	if err := ioutil.WriteFile(webConfig, newContent, 0666); err != nil {
+		log.LogError(fmt.Errorf("fix web.config failed: %s : %s", webConfig, err.Error()), false)
+		return false
+	}
+
+	return true
+}
+
+// VerifyWebConfig 检查web.config中aspNetCore的processPath及arguments指向的文件是否存在
+func VerifyWebConfig(webConfig string) bool {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(webConfig); err != nil {
+		log.LogError(fmt.Errorf("can not read web.config: %s : %s", webConfig, err.Error()), false)
+		return false
+	}
+
+	webDir := filepath.Dir(webConfig)
+	success := true
+
+	var check = func(attr string, path string) {
+		// 环境变量（如%LAUNCHER_PATH%）由IIS展开，无法检查
+		if path == "" || strings.Contains(path, "%") {
+			return
+		}
+		file := filepath.FromSlash(strings.ReplaceAll(path, "\\", "/"))
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(webDir, file)
+		}
+		if !util.PathExists(file) {
+			log.LogError(fmt.Errorf("web.config %s points to a missing file: %s", attr, path), false)
+			success = false
+		}
+	}
+
+	for _, aspNetCore := range doc.FindElements("//aspNetCore") {
+		processPath := aspNetCore.SelectAttrValue("processPath", "")
+		processName := strings.ToLower(filepath.Base(strings.ReplaceAll(processPath, "\\", "/")))
+
+		if processName == "dotnet" || processName == "dotnet.exe" {
+			entry, _ := splitFirstArgument(aspNetCore.SelectAttrValue("arguments", ""))
+			check("arguments", entry)
+			continue
+		}
+
+		check("processPath", processPath)
+	}
+
+	return success
+}
+
+var commentRegex = regexp.MustCompile(`(?s)<!--.*?-->|<!\[CDATA\[.*?\]\]>`)
+var aspNetCoreTagRegex = regexp.MustCompile(`<aspNetCore(?:\s(?:[^>"']|"[^"]*"|'[^']*')*)?>`)
+
+// aspNetCoreTags 所有aspNetCore开始标签的位置，跳过注释及CDATA
+func aspNetCoreTags(content []byte) [][]int {
+	comments := commentRegex.FindAllIndex(content, -1)
+
+	tags := make([][]int, 0)
+	for _, tag := range aspNetCoreTagRegex.FindAllIndex(content, -1) {
+		inComment := false
+		for _, comment := range comments {
+			if tag[0] >= comment[0] && tag[0] < comment[1] {
+				inComment = true
+				break
+			}
+		}
+		if !inComment {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// replaceAttr 替换开始标签中已存在的属性值，保留原有的引号
+func replaceAttr(tag []byte, name string, value string) []byte {
+	attrRegex := regexp.MustCompile(`(\s` + regexp.QuoteMeta(name) + `\s*=\s*)("[^"]*"|'[^']*')`)
+
+	return attrRegex.ReplaceAllFunc(tag, func(attr []byte) []byte {
+		match := attrRegex.FindSubmatch(attr)
+		quote := match[2][0]
+
+		escaped := strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "'", "&apos;").Replace(value)
+		if quote == '"' {
+			escaped = strings.ReplaceAll(escaped, "&apos;", "'")
+		} else {
+			escaped = strings.ReplaceAll(escaped, "&quot;", `"`)
+		}
+
+		replaced := append([]byte{}, match[1]...)
+		return append(append(append(replaced, quote), escaped...), quote)
+	})
+}
+
+// webRelativePath 与dotnet sdk生成的格式一致：.\App.exe
+func webRelativePath(webDir string, target string) string {
+	rel, err := filepath.Rel(webDir, target)
+	if err != nil {
+		rel = target
+	}
+	rel = strings.ReplaceAll(filepath.ToSlash(rel), "/", "\\")
+	if strings.HasPrefix(rel, "..") || filepath.IsAbs(target) && rel == target {
+		return rel
+	}
+	return ".\\" + rel
+}
+
+// splitFirstArgument 拆分出第一个参数（可能带引号）及剩余部分（保留前导空白）
+func splitFirstArgument(arguments string) (string, string) {
+	arguments = strings.TrimLeft(arguments, " \t")
+	if strings.HasPrefix(arguments, `"`) {
+		if end := strings.Index(arguments[1:], `"`); end != -1 {
+			return arguments[1 : end+1], arguments[end+2:]
+		}
+		return strings.Trim(arguments, `"`), ""
+	}
+	if end := strings.IndexAny(arguments, " \t"); end != -1 {
+		return arguments[:end], arguments[end:]
+	}
+	return arguments, ""
+}
+
+func quoteArgument(argument string) string {
+	if strings.ContainsAny(argument, " \t") {
+		return `"` + argument + `"`
+	}
+	return argument
+}
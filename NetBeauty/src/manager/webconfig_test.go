@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// webConfig dotnet sdk生成的web.config，带有注释及非默认缩进
+const webConfig = "<?xml version=\"1.0\" encoding=\"utf-8\"?>\r\n" +
+	"<configuration>\r\n" +
+	"\t<location path=\".\" inheritInChildApplications=\"false\">\r\n" +
+	"\t\t<system.webServer>\r\n" +
+	"\t\t\t<handlers>\r\n" +
+	"\t\t\t\t<add name=\"aspNetCore\" path=\"*\" verb=\"*\" modules=\"AspNetCoreModuleV2\" resourceType=\"Unspecified\" />\r\n" +
+	"\t\t\t</handlers>\r\n" +
+	"\t\t\t<!-- <aspNetCore processPath=\".\\Old.exe\" /> -->\r\n" +
+	"\t\t\t<aspNetCore processPath=\".\\App.exe\"   stdoutLogEnabled=\"false\"\r\n" +
+	"\t\t\t            stdoutLogFile=\".\\logs\\stdout\" hostingModel=\"inprocess\" />\r\n" +
+	"\t\t\t<aspNetCore processPath='dotnet' arguments='.\\App.dll --urls \"http://*:80\"' />\r\n" +
+	"\t\t</system.webServer>\r\n" +
+	"\t</location>\r\n" +
+	"</configuration>\r\n" +
+	"<!--ProjectGuid: 00000000-0000-0000-0000-000000000000-->"
+
+func TestFixWebConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "web.config")
+	if err := ioutil.WriteFile(file, []byte(webConfig), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if !FixWebConfig(file, "App", filepath.Join(dir, "bin", "App.exe"), filepath.Join(dir, "bin", "App.dll")) {
+		t.Fatal("FixWebConfig failed")
+	}
+
+	// 只有两个属性值发生变化
+	want := strings.NewReplacer(
+		`<aspNetCore processPath=".\App.exe"`, `<aspNetCore processPath=".\bin\App.exe"`,
+		`arguments='.\App.dll --urls "http://*:80"'`, `arguments='.\bin\App.dll --urls "http://*:80"'`,
+	).Replace(webConfig)
+
+	content, _ := ioutil.ReadFile(file)
+	if string(content) != want {
+		t.Errorf("web.config =\n%s\nwant\n%s", content, want)
+	}
+
+	if VerifyWebConfig(file) {
+		t.Error("VerifyWebConfig succeeded with missing files")
+	}
+
+	os.MkdirAll(filepath.Join(dir, "bin"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "bin", "App.exe"), nil, 0666)
+	ioutil.WriteFile(filepath.Join(dir, "bin", "App.dll"), nil, 0666)
+
+	if !VerifyWebConfig(file) {
+		t.Error("VerifyWebConfig failed with existing files")
+	}
+}
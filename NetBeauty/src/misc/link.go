@@ -0,0 +1,160 @@
+package misc
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/nulastudio/NetBeauty/src/util"
+)
+
+// 文件的放置方式
+const (
+	// MoveMode 移动，跨设备时回退到复制+删除
+	MoveMode = "move"
+	// CopyMode 复制，保留原文件
+	CopyMode = "copy"
+	// HardlinkMode 硬链接，保留原文件，不支持时回退到复制
+	HardlinkMode = "hardlink"
+	// SymlinkMode 移动并在原位置留下符号链接
+	SymlinkMode = "symlink"
+	// ReflinkMode 写时复制（CoW），保留原文件，不支持时回退到复制
+	ReflinkMode = "reflink"
+)
+
+// LinkModes 所有支持的放置方式
+var LinkModes = []string{MoveMode, CopyMode, HardlinkMode, SymlinkMode, ReflinkMode}
+
+// rename 测试中替换以模拟跨设备移动
+var rename = os.Rename
+
+// PlaceFile 按mode将src（文件或目录）放置到dst，返回实际使用的方式
+func PlaceFile(src string, dst string, mode string) (string, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return mode, err
+	}
+
+	// 上次已经以链接方式放置过
+	if srcInfo, err := os.Stat(src); err == nil {
+		if dstInfo, err := os.Stat(dst); err == nil && os.SameFile(srcInfo, dstInfo) {
+			if info.Mode()&os.ModeSymlink != 0 || (mode != MoveMode && mode != SymlinkMode) {
+				return mode, nil
+			}
+			if err := os.Remove(src); err != nil {
+				return mode, err
+			}
+			if mode == SymlinkMode {
+				used, _ := symlink(src, dst)
+				return used, nil
+			}
+			return MoveMode, nil
+		}
+	}
+
+	switch mode {
+	case CopyMode, HardlinkMode, ReflinkMode:
+		if info.IsDir() {
+			return placeDir(src, dst, mode)
+		}
+		return placeFile(src, dst, mode)
+	case SymlinkMode:
+		used, err := move(src, dst, info)
+		if err != nil {
+			return used, err
+		}
+		if _, err := symlink(src, dst); err != nil {
+			// 不支持符号链接时（如Windows未开启开发者模式）只移动
+			return used, nil
+		}
+		return SymlinkMode, nil
+	default:
+		return move(src, dst, info)
+	}
+}
+
+// symlink 在src处创建指向dst的相对链接
+func symlink(src string, dst string) (string, error) {
+	target, err := filepath.Rel(filepath.Dir(src), dst)
+	if err != nil {
+		target = dst
+	}
+	if err := os.Symlink(target, src); err != nil {
+		return MoveMode, err
+	}
+	return SymlinkMode, nil
+}
+
+// move 移动文件或目录，跨设备无法rename时复制后删除
+func move(src string, dst string, info os.FileInfo) (string, error) {
+	err := rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return MoveMode, err
+	}
+
+	if info.IsDir() {
+		_, err = placeDir(src, dst, CopyMode)
+	} else {
+		_, err = placeFile(src, dst, CopyMode)
+	}
+	if err != nil {
+		os.RemoveAll(dst)
+		return CopyMode, err
+	}
+
+	return CopyMode + "+delete", os.RemoveAll(src)
+}
+
+func placeDir(src string, dst string, mode string) (string, error) {
+	used := mode
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		// 符号链接（包括失效的链接）保持为链接，相对目标在新目录中同样有效
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		}
+		u, err := placeFile(path, target, mode)
+		if u != mode {
+			used = u
+		}
+		return err
+	})
+	return used, err
+}
+
+func placeFile(src string, dst string, mode string) (string, error) {
+	// 目标可能是指向src的旧链接，必须先删除
+	os.Remove(dst)
+
+	switch mode {
+	case HardlinkMode:
+		if os.Link(src, dst) == nil {
+			return HardlinkMode, nil
+		}
+	case ReflinkMode:
+		if Reflink(src, dst) == nil {
+			return ReflinkMode, nil
+		}
+		os.Remove(dst)
+	}
+
+	_, err := util.CopyFile(src, dst)
+	return CopyMode, err
+}
+
+// isCrossDevice 是否为跨设备rename失败
+func isCrossDevice(err error) bool {
+	linkErr, ok := err.(*os.LinkError)
+	return ok && linkErr.Err == errCrossDevice
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package misc
+
+import "syscall"
+
+// errCrossDevice 跨设备rename的错误
+var errCrossDevice error = syscall.EXDEV
@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package misc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlaceDirKeepsSymlinks(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "app")
+	dst := filepath.Join(dir, "out")
+	writeFile(t, filepath.Join(src, "libfoo.so.1"), "foo")
+	os.Symlink("libfoo.so.1", filepath.Join(src, "libfoo.so"))
+	os.Symlink("missing.so", filepath.Join(src, "dangling.so"))
+
+	if _, err := PlaceFile(src, dst, CopyMode); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, target := range map[string]string{"libfoo.so": "libfoo.so.1", "dangling.so": "missing.so"} {
+		link, err := os.Readlink(filepath.Join(dst, name))
+		if err != nil || link != target {
+			t.Errorf("%s: symlink not kept: %q %v", name, link, err)
+		}
+	}
+	if readFile(t, filepath.Join(dst, "libfoo.so")) != "foo" {
+		t.Error("relative symlink does not resolve in the copy")
+	}
+}
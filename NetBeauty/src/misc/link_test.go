@@ -0,0 +1,184 @@
+package misc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	os.MkdirAll(filepath.Dir(path), 0777)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func sameFile(a string, b string) bool {
+	infoA, err1 := os.Stat(a)
+	infoB, err2 := os.Stat(b)
+	return err1 == nil && err2 == nil && os.SameFile(infoA, infoB)
+}
+
+func TestPlaceFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, mode := range LinkModes {
+		src := filepath.Join(dir, mode, "a.dll")
+		dst := filepath.Join(dir, mode, "libs", "a.dll")
+		writeFile(t, src, mode)
+		os.Chtimes(src, mtime, mtime)
+		os.MkdirAll(filepath.Dir(dst), 0777)
+
+		used, err := PlaceFile(src, dst, mode)
+		if err != nil {
+			t.Errorf("%s: %s", mode, err.Error())
+			continue
+		}
+		if readFile(t, dst) != mode {
+			t.Errorf("%s: wrong content", mode)
+		}
+
+		srcInfo, srcErr := os.Lstat(src)
+
+		switch mode {
+		case MoveMode:
+			if srcErr == nil {
+				t.Errorf("%s: source is kept", mode)
+			}
+		case CopyMode, ReflinkMode:
+			if used != mode && used != CopyMode {
+				t.Errorf("%s: used %s", mode, used)
+			}
+			if srcErr != nil || (used == CopyMode && sameFile(src, dst)) {
+				t.Errorf("%s: source is not kept as a separate file", mode)
+			}
+			// 复制时保留修改时间
+			if info, err := os.Stat(dst); err != nil || !info.ModTime().Equal(mtime) {
+				t.Errorf("%s: modification time is not kept", mode)
+			}
+		case HardlinkMode:
+			if used == HardlinkMode && !sameFile(src, dst) {
+				t.Errorf("%s: not linked", mode)
+			}
+		case SymlinkMode:
+			if used == SymlinkMode && (srcErr != nil || srcInfo.Mode()&os.ModeSymlink == 0 || !sameFile(src, dst)) {
+				t.Errorf("%s: source is not a link to the target", mode)
+			}
+		}
+	}
+}
+
+func TestPlaceDir(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "x64")
+	dst := filepath.Join(dir, "libs", "x64")
+	writeFile(t, filepath.Join(src, "sub", "a.so"), "a")
+	os.MkdirAll(filepath.Dir(dst), 0777)
+
+	if _, err := PlaceFile(src, dst, CopyMode); err != nil {
+		t.Fatal(err)
+	}
+	if readFile(t, filepath.Join(dst, "sub", "a.so")) != "a" || readFile(t, filepath.Join(src, "sub", "a.so")) != "a" {
+		t.Error("directory is not copied")
+	}
+}
+
+func TestPlaceFileRerun(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "a.dll")
+	dst := filepath.Join(dir, "libs", "a.dll")
+	writeFile(t, src, "a")
+	os.MkdirAll(filepath.Dir(dst), 0777)
+
+	used, err := PlaceFile(src, dst, SymlinkMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != SymlinkMode {
+		t.Skip("symbolic links are not supported")
+	}
+
+	// 再次运行时src是指向dst的链接，不能删除或覆盖dst
+	for _, mode := range []string{SymlinkMode, CopyMode, MoveMode} {
+		if _, err := PlaceFile(src, dst, mode); err != nil {
+			t.Errorf("%s: %s", mode, err.Error())
+		}
+		if readFile(t, dst) != "a" {
+			t.Fatalf("%s: target is damaged", mode)
+		}
+	}
+
+	// 上次以硬链接放置后改为move，只删除原位置
+	os.Remove(src)
+	if err := os.Link(dst, src); err != nil {
+		t.Skip("hard links are not supported")
+	}
+	if used, err := PlaceFile(src, dst, MoveMode); err != nil || used != MoveMode {
+		t.Errorf("move after hardlink = %s, %v", used, err)
+	}
+	if _, err := os.Lstat(src); err == nil || readFile(t, dst) != "a" {
+		t.Error("move after hardlink: source is kept or target is damaged")
+	}
+}
+
+func TestPlaceFileCrossDevice(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	defer func() { rename = os.Rename }()
+	rename = func(src string, dst string) error {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: errCrossDevice}
+	}
+
+	for _, name := range []string{"a.dll", "x64"} {
+		src := filepath.Join(dir, name)
+		dst := filepath.Join(dir, "libs", name)
+		file := src
+		if name == "x64" {
+			file = filepath.Join(src, "a.so")
+		}
+		writeFile(t, file, name)
+		os.MkdirAll(filepath.Dir(dst), 0777)
+
+		used, err := PlaceFile(src, dst, MoveMode)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+		if used != CopyMode+"+delete" {
+			t.Errorf("%s: used %s, want %s+delete", name, used, CopyMode)
+		}
+		if _, err := os.Lstat(src); err == nil {
+			t.Errorf("%s: source is kept", name)
+		}
+
+		rel, _ := filepath.Rel(src, file)
+		if readFile(t, filepath.Join(dst, rel)) != name {
+			t.Errorf("%s: wrong content", name)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package misc
+
+import "syscall"
+
+// errCrossDevice ERROR_NOT_SAME_DEVICE
+var errCrossDevice error = syscall.Errno(17)
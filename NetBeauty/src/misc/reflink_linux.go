@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package misc
+
+import (
+	"os"
+	"syscall"
+)
+
+// FICLONE ioctl，btrfs/xfs等文件系统支持
+const ficlone = 0x40049409
+
+// Reflink 创建src的写时复制副本
+func Reflink(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd()); errno != 0 {
+		return &os.LinkError{Op: "reflink", Old: src, New: dst, Err: errno}
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package misc
+
+import (
+	"errors"
+	"os"
+)
+
+// Reflink 创建src的写时复制副本，仅支持Linux
+func Reflink(src string, dst string) error {
+	return &os.LinkError{Op: "reflink", Old: src, New: dst, Err: errors.New("not supported")}
+}
@@ -0,0 +1,309 @@
+package ojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// Object 保持键顺序的JSON对象，值以原始JSON保存，未改动的部分原样写回
+type Object struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// Format JSON文件的原始格式
+type Format struct {
+	BOM          bool
+	CRLF         bool
+	Indent       string
+	FinalNewline bool
+}
+
+// DefaultFormat 新建文件时使用的格式（与dotnet sdk一致）
+var DefaultFormat = Format{
+	BOM:          false,
+	CRLF:         false,
+	Indent:       "  ",
+	FinalNewline: false,
+}
+
+// NewObject 创建空对象
+func NewObject() *Object {
+	return &Object{
+		keys:   make([]string, 0),
+		values: make(map[string]json.RawMessage),
+	}
+}
+
+// Len 键数量
+func (o *Object) Len() int {
+	if o == nil {
+		return 0
+	}
+	return len(o.keys)
+}
+
+// Keys 按原始顺序返回所有键
+func (o *Object) Keys() []string {
+	if o == nil {
+		return []string{}
+	}
+	keys := make([]string, len(o.keys))
+	copy(keys, o.keys)
+	return keys
+}
+
+// Has 是否存在某个键
+func (o *Object) Has(key string) bool {
+	if o == nil {
+		return false
+	}
+	_, ok := o.values[key]
+	return ok
+}
+
+// Raw 取原始JSON值
+func (o *Object) Raw(key string) json.RawMessage {
+	if o == nil {
+		return nil
+	}
+	return o.values[key]
+}
+
+// Get 解码某个键的值，键不存在时返回false
+func (o *Object) Get(key string, v interface{}) (bool, error) {
+	raw := o.Raw(key)
+	if raw == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Set 设置某个键的值，已存在的键保持原位置，新键追加到末尾
+func (o *Object) Set(key string, v interface{}) error {
+	raw, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	o.SetRaw(key, raw)
+	return nil
+}
+
+// SetRaw 以原始JSON设置某个键的值
+func (o *Object) SetRaw(key string, raw json.RawMessage) {
+	if o.values == nil {
+		o.values = make(map[string]json.RawMessage)
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = raw
+}
+
+// Delete 删除某个键
+func (o *Object) Delete(key string) {
+	if !o.Has(key) {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// UnmarshalJSON 实现json.Unmarshaler
+func (o *Object) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected object, got %s", Kind(data))
+	}
+
+	o.keys = make([]string, 0)
+	o.values = make(map[string]json.RawMessage)
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return errors.New("invalid object key")
+		}
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return err
+		}
+
+		o.SetRaw(key, raw)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler
+func (o *Object) MarshalJSON() ([]byte, error) {
+	if o == nil {
+		return []byte("null"), nil
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		keyBytes, err := Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(keyBytes)
+		buf.WriteByte(':')
+
+		raw := o.values[key]
+		if len(raw) == 0 {
+			raw = json.RawMessage("null")
+		}
+		buf.Write(raw)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// Marshal 与json.Marshal一致，但不转义HTML字符
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// DetectFormat 识别BOM、换行符及缩进
+func DetectFormat(data []byte) Format {
+	format := DefaultFormat
+
+	if bytes.HasPrefix(data, utf8BOM) {
+		format.BOM = true
+		data = data[len(utf8BOM):]
+	}
+
+	format.CRLF = bytes.Contains(data, []byte("\r\n"))
+
+	trimmed := bytes.TrimRight(data, " \t")
+	format.FinalNewline = bytes.HasSuffix(trimmed, []byte("\n"))
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+		if len(indent) != 0 && len(bytes.TrimSpace(line)) != 0 {
+			format.Indent = string(indent)
+			break
+		}
+	}
+
+	return format
+}
+
+// Unmarshal 解码JSON（自动去除BOM）并返回原始格式
+func Unmarshal(data []byte, v interface{}) (Format, error) {
+	format := DetectFormat(data)
+
+	return format, json.Unmarshal(bytes.TrimPrefix(data, utf8BOM), v)
+}
+
+// MarshalFormat 按指定格式编码JSON
+func MarshalFormat(v interface{}, format Format) ([]byte, error) {
+	compact, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	if format.BOM {
+		buf.Write(utf8BOM)
+	}
+
+	if format.Indent == "" {
+		buf.Write(compact)
+	} else if err := json.Indent(&buf, compact, "", format.Indent); err != nil {
+		return nil, err
+	}
+
+	if format.FinalNewline {
+		buf.WriteByte('\n')
+	}
+
+	result := buf.Bytes()
+
+	if format.CRLF {
+		result = bytes.Replace(result, []byte("\n"), []byte("\r\n"), -1)
+	}
+
+	return result, nil
+}
+
+// ReadFile 读取并解码JSON文件
+func ReadFile(path string, v interface{}) (Format, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return DefaultFormat, err
+	}
+	return Unmarshal(data, v)
+}
+
+// WriteFile 按指定格式写入JSON文件
+func WriteFile(path string, v interface{}, format Format, perm os.FileMode) error {
+	data, err := MarshalFormat(v, format)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, perm)
+}
+
+// Kind JSON值的类型名称
+func Kind(data []byte) string {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return "nothing"
+	}
+	switch data[0] {
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	case '{':
+		return "object"
+	}
+	return "number"
+}
@@ -0,0 +1,92 @@
+package ojson
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"default", "{\n  \"b\": 1,\n  \"a\": {\n    \"z\": [\n      1,\n      2\n    ],\n    \"y\": \"<&>\"\n  }\n}"},
+		{"crlf and final newline", "{\r\n    \"b\": true,\r\n    \"a\": null\r\n}\r\n"},
+		{"bom and tabs", "\xef\xbb\xbf{\n\t\"x\": \"y\"\n}\n"},
+	}
+
+	for _, test := range tests {
+		object := NewObject()
+		format, err := Unmarshal([]byte(test.data), object)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		data, err := MarshalFormat(object, format)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !bytes.Equal(data, []byte(test.data)) {
+			t.Errorf("%s: round trip changed the file:\n%q\n%q", test.name, test.data, data)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		data   string
+		format Format
+	}{
+		{"{\n  \"a\": 1\n}", Format{Indent: "  "}},
+		{"\xef\xbb\xbf{\r\n    \"a\": 1\r\n}\r\n", Format{BOM: true, CRLF: true, Indent: "    ", FinalNewline: true}},
+		{"{\"a\":1}\n", Format{Indent: "  ", FinalNewline: true}},
+	}
+
+	for _, test := range tests {
+		if format := DetectFormat([]byte(test.data)); format != test.format {
+			t.Errorf("DetectFormat(%q) = %+v, want %+v", test.data, format, test.format)
+		}
+	}
+}
+
+func TestObjectOrder(t *testing.T) {
+	object := NewObject()
+	if _, err := Unmarshal([]byte(`{"c":1,"a":2,"b":3}`), object); err != nil {
+		t.Fatal(err)
+	}
+
+	object.Set("a", 4)
+	object.Set("d", 5)
+	object.Delete("c")
+
+	data, _ := object.MarshalJSON()
+	if want := `{"a":4,"b":3,"d":5}`; string(data) != want {
+		t.Errorf("MarshalJSON = %s, want %s", data, want)
+	}
+}
+
+func TestUnmarshalNotObject(t *testing.T) {
+	for _, data := range []string{`[]`, `"a"`, `1`, `{"a":}`} {
+		if _, err := Unmarshal([]byte(data), NewObject()); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want error", data)
+		}
+	}
+}
+
+func TestKind(t *testing.T) {
+	tests := map[string]string{
+		``:      "nothing",
+		` [1]`:  "array",
+		`"a"`:   "string",
+		`false`: "boolean",
+		`null`:  "null",
+		`{}`:    "object",
+		`-1.5`:  "number",
+	}
+
+	for data, kind := range tests {
+		if got := Kind([]byte(data)); got != kind {
+			t.Errorf("Kind(%q) = %s, want %s", data, got, kind)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package pack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DOS隐藏属性，位于zip外部属性的低16位
+const dosHidden = 0x02
+
+// creatorFAT 创建系统为FAT的条目，Windows资源管理器及7-Zip仅对这类条目应用DOS属性
+const creatorFAT = 0
+
+// zip中的时间不能早于1980-01-01
+var minZipTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// entry 归档中的一项
+type entry struct {
+	name string
+	path string
+	info os.FileInfo
+}
+
+// ModTime 归档中统一使用的时间，取自SOURCE_DATE_EPOCH，未设置时为1980-01-01
+func ModTime() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return minZipTime, nil
+	}
+
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("invalid SOURCE_DATE_EPOCH: " + epoch)
+	}
+
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// Pack 将目录打包为zip或tar.gz，条目按名称排序，hidden决定zip中哪些文件及目录带有DOS隐藏属性
+// 硬链接在tar.gz中保留为硬链接，zip不支持硬链接，每个文件都完整写入
+func Pack(dir string, out string, modTime time.Time, hidden func(name string) bool) error {
+	entries, err := collect(dir, out)
+	if err != nil {
+		return err
+	}
+
+	lower := strings.ToLower(out)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return writeArchive(out, func(w io.Writer) error {
+			return writeZip(w, entries, modTime, hidden)
+		})
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		return writeArchive(out, func(w io.Writer) error {
+			return writeTarGz(w, entries, modTime)
+		})
+	default:
+		return errors.New("unsupported archive format: " + out)
+	}
+}
+
+// collect 收集目录下所有的文件、目录及符号链接，跳过输出文件自身
+func collect(dir string, out string) ([]entry, error) {
+	absOut, _ := filepath.Abs(out)
+	entries := make([]entry, 0)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		if rel == "." {
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == absOut {
+			return nil
+		}
+
+		name := filepath.ToSlash(rel)
+		if info.IsDir() {
+			name += "/"
+		}
+		entries = append(entries, entry{name: name, path: path, info: info})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	return entries, nil
+}
+
+func writeArchive(out string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0777); err != nil {
+		return err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+
+	return f.Close()
+}
+
+// content 文件内容，符号链接为链接目标
+func (e entry) content() (io.ReadCloser, error) {
+	if e.info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(e.path)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(strings.NewReader(filepath.ToSlash(target))), nil
+	}
+	return os.Open(e.path)
+}
+
+func writeZip(w io.Writer, entries []entry, modTime time.Time, hidden func(name string) bool) error {
+	if modTime.Before(minZipTime) {
+		modTime = minZipTime
+	}
+
+	zw := zip.NewWriter(w)
+
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: modTime}
+		if e.info.IsDir() {
+			header.Method = zip.Store
+		}
+		// 高16位为Unix权限，低16位为DOS属性
+		header.SetMode(e.info.Mode())
+		// 隐藏的条目标记为FAT创建，高16位仍写入Unix权限，但Info-ZIP的unzip对这类条目使用默认权限
+		if hidden != nil && hidden(strings.TrimSuffix(e.name, "/")) {
+			header.CreatorVersion = creatorFAT<<8 | header.CreatorVersion&0xff
+			header.ExternalAttrs |= dosHidden
+		}
+
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if e.info.IsDir() {
+			continue
+		}
+
+		if err := copyContent(writer, e); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, entries []entry, modTime time.Time) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	// 已写入的普通文件，按大小分组，用于识别硬链接
+	written := make(map[int64][]entry)
+
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:     e.name,
+			Mode:     int64(e.info.Mode().Perm()),
+			ModTime:  modTime,
+			Typeflag: tar.TypeReg,
+			Size:     e.info.Size(),
+		}
+
+		switch {
+		case e.info.IsDir():
+			header.Typeflag = tar.TypeDir
+			header.Size = 0
+		case e.info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(e.path)
+			if err != nil {
+				return err
+			}
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = filepath.ToSlash(target)
+			header.Size = 0
+		case e.info.Mode().IsRegular():
+			if link := findHardlink(written[e.info.Size()], e); link != nil {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = link.name
+				header.Size = 0
+			} else {
+				written[e.info.Size()] = append(written[e.info.Size()], e)
+			}
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := copyContent(tw, e); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// findHardlink 查找与e是同一个文件的已写入条目
+func findHardlink(entries []entry, e entry) *entry {
+	for i := range entries {
+		if os.SameFile(entries[i].info, e.info) {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func copyContent(w io.Writer, e entry) error {
+	r, err := e.content()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return err
+}
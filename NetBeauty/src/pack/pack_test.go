@@ -0,0 +1,108 @@
+package pack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempApp(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := filepath.Join(dir, "app")
+	os.MkdirAll(filepath.Join(app, "libs"), 0755)
+	for _, name := range []string{"App.dll", "App.deps.json", "libs/a.dll"} {
+		if err := ioutil.WriteFile(filepath.Join(app, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestZipHidden(t *testing.T) {
+	dir := tempApp(t)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "app.zip")
+	hidden := func(name string) bool {
+		return name == "App.deps.json" || name == "libs"
+	}
+	if err := Pack(filepath.Join(dir, "app"), out, minZipTime, hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		isHidden := f.Name == "App.deps.json" || f.Name == "libs/"
+		creator := f.CreatorVersion >> 8
+		if isHidden && (creator != creatorFAT || f.ExternalAttrs&dosHidden == 0) {
+			t.Errorf("%s: not hidden: creator %d, attrs %#x", f.Name, creator, f.ExternalAttrs)
+		}
+		if !isHidden && (creator == creatorFAT || f.ExternalAttrs&dosHidden != 0) {
+			t.Errorf("%s: hidden: creator %d, attrs %#x", f.Name, creator, f.ExternalAttrs)
+		}
+		// Unix权限始终保留在高16位
+		if perm := os.FileMode(f.ExternalAttrs >> 16).Perm(); perm == 0 {
+			t.Errorf("%s: unix mode lost: %#x", f.Name, f.ExternalAttrs)
+		}
+	}
+}
+
+func TestTarGzHardlink(t *testing.T) {
+	dir := tempApp(t)
+	defer os.RemoveAll(dir)
+
+	app := filepath.Join(dir, "app")
+	if err := os.Link(filepath.Join(app, "libs", "a.dll"), filepath.Join(app, "libs", "b.dll")); err != nil {
+		t.Skip("hardlinks not supported: " + err.Error())
+	}
+
+	out := filepath.Join(dir, "app.tar.gz")
+	if err := Pack(app, out, minZipTime, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+
+	headers := make(map[string]*tar.Header)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		headers[header.Name] = header
+	}
+
+	if a := headers["libs/a.dll"]; a == nil || a.Typeflag != tar.TypeReg || a.Size != int64(len("libs/a.dll")) {
+		t.Errorf("libs/a.dll: %+v", a)
+	}
+	if b := headers["libs/b.dll"]; b == nil || b.Typeflag != tar.TypeLink || b.Linkname != "libs/a.dll" {
+		t.Errorf("libs/b.dll: %+v", b)
+	}
+	if app := headers["App.dll"]; app == nil || app.Typeflag != tar.TypeReg {
+		t.Errorf("App.dll: %+v", app)
+	}
+}
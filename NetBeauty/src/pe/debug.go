@@ -0,0 +1,90 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// DirectoryEntryDebug 调试目录
+const DirectoryEntryDebug = 6
+
+const (
+	debugTypeCodeView = 2
+	// portable PDB的CodeView记录MinorVersion为'PM'
+	portablePdbMinorVersion = 0x504d
+)
+
+// CodeView 调试目录中的CodeView（RSDS）记录
+type CodeView struct {
+	GUID     string
+	Age      uint32
+	Path     string
+	Portable bool
+}
+
+// ReadCodeView 读取PE调试目录中的CodeView记录
+func ReadCodeView(data []byte) (*CodeView, error) {
+	header, err := ReadHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(header.DataDirectory) <= DirectoryEntryDebug || header.DataDirectory[DirectoryEntryDebug].VirtualAddress == 0 {
+		return nil, errors.New("no debug directory")
+	}
+
+	directory := header.DataDirectory[DirectoryEntryDebug]
+	offset, ok := header.rvaToOffset(data, directory.VirtualAddress)
+	if !ok {
+		return nil, errors.New("invalid debug directory")
+	}
+
+	for entry := offset; entry+28 <= offset+int(directory.Size) && entry+28 <= len(data); entry += 28 {
+		minorVersion := binary.LittleEndian.Uint16(data[entry+10:])
+		debugType := binary.LittleEndian.Uint32(data[entry+12:])
+		size := int(binary.LittleEndian.Uint32(data[entry+16:]))
+		pointer := int(binary.LittleEndian.Uint32(data[entry+24:]))
+
+		if debugType != debugTypeCodeView {
+			continue
+		}
+
+		if pointer+24 > len(data) || size < 24 || pointer+size > len(data) || string(data[pointer:pointer+4]) != "RSDS" {
+			return nil, errors.New("invalid CodeView record")
+		}
+
+		guid := data[pointer+4 : pointer+20]
+		pdbPath := data[pointer+24 : pointer+size]
+		if i := bytes.IndexByte(pdbPath, 0); i != -1 {
+			pdbPath = pdbPath[:i]
+		}
+
+		return &CodeView{
+			GUID:     formatGUID(guid),
+			Age:      binary.LittleEndian.Uint32(data[pointer+20:]),
+			Path:     string(pdbPath),
+			Portable: minorVersion == portablePdbMinorVersion,
+		}, nil
+	}
+
+	return nil, errors.New("no CodeView record")
+}
+
+// PdbName PDB文件名（不含目录）
+func (c *CodeView) PdbName() string {
+	return path.Base(strings.ReplaceAll(c.Path, "\\", "/"))
+}
+
+// SymbolKey 符号服务器（SSQP）中PDB的key：<pdb>/<guid><age>/<pdb>，portable PDB的age固定为ffffffff
+func (c *CodeView) SymbolKey() string {
+	name := strings.ToLower(c.PdbName())
+	age := fmt.Sprintf("%x", c.Age)
+	if c.Portable {
+		age = "ffffffff"
+	}
+	return name + "/" + c.GUID + age + "/" + name
+}
@@ -0,0 +1,492 @@
+package pe
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ECMA-335 II.22 元数据表编号（只列出计算行大小所需的表）
+const (
+	tableModule                 = 0x00
+	tableTypeRef                = 0x01
+	tableTypeDef                = 0x02
+	tableFieldPtr               = 0x03
+	tableField                  = 0x04
+	tableMethodPtr              = 0x05
+	tableMethodDef              = 0x06
+	tableParamPtr               = 0x07
+	tableParam                  = 0x08
+	tableInterfaceImpl          = 0x09
+	tableMemberRef              = 0x0a
+	tableConstant               = 0x0b
+	tableCustomAttribute        = 0x0c
+	tableFieldMarshal           = 0x0d
+	tableDeclSecurity           = 0x0e
+	tableClassLayout            = 0x0f
+	tableFieldLayout            = 0x10
+	tableStandAloneSig          = 0x11
+	tableEventMap               = 0x12
+	tableEventPtr               = 0x13
+	tableEvent                  = 0x14
+	tablePropertyMap            = 0x15
+	tablePropertyPtr            = 0x16
+	tableProperty               = 0x17
+	tableMethodSemantics        = 0x18
+	tableMethodImpl             = 0x19
+	tableModuleRef              = 0x1a
+	tableTypeSpec               = 0x1b
+	tableImplMap                = 0x1c
+	tableFieldRVA               = 0x1d
+	tableEncLog                 = 0x1e
+	tableEncMap                 = 0x1f
+	tableAssembly               = 0x20
+	tableAssemblyProcessor      = 0x21
+	tableAssemblyOS             = 0x22
+	tableAssemblyRef            = 0x23
+	tableFile                   = 0x26
+	tableExportedType           = 0x27
+	tableManifestResource       = 0x28
+	tableGenericParam           = 0x2a
+	tableMethodSpec             = 0x2b
+	tableGenericParamConstraint = 0x2c
+
+	tableCount = 64
+)
+
+const metadataSignature = 0x424a5342
+
+// assemblyRefFlagPublicKey AssemblyRef中存放的是完整公钥而不是公钥标记
+const assemblyRefFlagPublicKey = 0x0001
+
+// 编码索引（ECMA-335 II.24.2.6），unused表示占位的标记值
+const unused = -1
+
+var (
+	typeDefOrRef        = []int{tableTypeDef, tableTypeRef, tableTypeSpec}
+	hasConstant         = []int{tableField, tableParam, tableProperty}
+	hasCustomAttribute  = []int{tableMethodDef, tableField, tableTypeRef, tableTypeDef, tableParam, tableInterfaceImpl, tableMemberRef, tableModule, tableDeclSecurity, tableProperty, tableEvent, tableStandAloneSig, tableModuleRef, tableTypeSpec, tableAssembly, tableAssemblyRef, tableFile, tableExportedType, tableManifestResource, tableGenericParam, tableGenericParamConstraint, tableMethodSpec}
+	hasFieldMarshal     = []int{tableField, tableParam}
+	hasDeclSecurity     = []int{tableTypeDef, tableMethodDef, tableAssembly}
+	memberRefParent     = []int{tableTypeDef, tableTypeRef, tableModuleRef, tableMethodDef, tableTypeSpec}
+	hasSemantics        = []int{tableEvent, tableProperty}
+	methodDefOrRef      = []int{tableMethodDef, tableMemberRef}
+	memberForwarded     = []int{tableField, tableMethodDef}
+	customAttributeType = []int{unused, unused, tableMethodDef, tableMemberRef, unused}
+	resolutionScope     = []int{tableModule, tableModuleRef, tableAssemblyRef, tableTypeRef}
+)
+
+// AssemblyIdentity 程序集标识
+type AssemblyIdentity struct {
+	Name           string
+	Version        string
+	Culture        string
+	PublicKeyToken string
+}
+
+// String 与程序集显示名称一致
+func (a AssemblyIdentity) String() string {
+	return fmt.Sprintf("%s, Version=%s, Culture=%s, PublicKeyToken=%s", a.Name, a.Version, a.Culture, a.PublicKeyToken)
+}
+
+// Metadata 程序集元数据中的程序集标识及其引用
+type Metadata struct {
+	Assembly   *AssemblyIdentity
+	References []AssemblyIdentity
+}
+
+type metadataReader struct {
+	tables     []byte
+	strings    []byte
+	blob       []byte
+	rows       [tableCount]int
+	stringSize int
+	guidSize   int
+	blobSize   int
+}
+
+// ReadMetadata 读取托管程序集的Assembly及AssemblyRef表
+func ReadMetadata(data []byte) (*Metadata, error) {
+	header, err := ReadHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !header.IsManaged() {
+		return nil, errors.New("not a managed assembly")
+	}
+
+	cliDirectory := header.DataDirectory[DirectoryEntryCOMDescriptor]
+	cliOffset, ok := header.rvaToOffset(data, cliDirectory.VirtualAddress)
+	if !ok || cliOffset+16 > len(data) {
+		return nil, errors.New("invalid CLI header")
+	}
+
+	metadataOffset, ok := header.rvaToOffset(data, binary.LittleEndian.Uint32(data[cliOffset+8:]))
+	metadataSize := int(binary.LittleEndian.Uint32(data[cliOffset+12:]))
+	if !ok || metadataOffset+metadataSize > len(data) || metadataSize < 16 {
+		return nil, errors.New("invalid metadata directory")
+	}
+
+	streams, err := metadataStreams(data[metadataOffset : metadataOffset+metadataSize])
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &metadataReader{}
+
+	for name, stream := range streams {
+		switch name {
+		case "#~", "#-":
+			reader.tables = stream
+		case "#Strings":
+			reader.strings = stream
+		case "#Blob":
+			reader.blob = stream
+		}
+	}
+
+	if reader.tables == nil {
+		return nil, errors.New("metadata tables stream not found")
+	}
+
+	return reader.read()
+}
+
+// metadataStreams 读取元数据根（ECMA-335 II.24.2.1）中的所有流（名称 => 内容）
+func metadataStreams(root []byte) (map[string][]byte, error) {
+	if len(root) < 16 || binary.LittleEndian.Uint32(root) != metadataSignature {
+		return nil, errors.New("invalid metadata signature")
+	}
+
+	versionLength := int(binary.LittleEndian.Uint32(root[12:]))
+	offset := 16 + versionLength
+	if offset+4 > len(root) {
+		return nil, errors.New("invalid metadata root")
+	}
+
+	streamCount := int(binary.LittleEndian.Uint16(root[offset+2:]))
+	offset += 4
+
+	streams := make(map[string][]byte)
+
+	for i := 0; i < streamCount; i++ {
+		if offset+8 > len(root) {
+			return nil, errors.New("invalid stream header")
+		}
+
+		streamOffset := int(binary.LittleEndian.Uint32(root[offset:]))
+		streamSize := int(binary.LittleEndian.Uint32(root[offset+4:]))
+		offset += 8
+
+		nameEnd := offset
+		for nameEnd < len(root) && root[nameEnd] != 0 {
+			nameEnd++
+		}
+		name := string(root[offset:nameEnd])
+		// 流名称以\0结尾并按4字节对齐
+		offset = (nameEnd + 4) &^ 3
+
+		if streamOffset+streamSize > len(root) {
+			return nil, fmt.Errorf("invalid stream: %s", name)
+		}
+
+		streams[name] = root[streamOffset : streamOffset+streamSize]
+	}
+
+	return streams, nil
+}
+
+func (h *Header) rvaToOffset(data []byte, rva uint32) (int, bool) {
+	for i := 0; i < h.sectionCount; i++ {
+		section := h.sectionOffset + 40*i
+		if section+40 > len(data) {
+			return 0, false
+		}
+
+		virtualSize := binary.LittleEndian.Uint32(data[section+8:])
+		virtualAddress := binary.LittleEndian.Uint32(data[section+12:])
+		rawSize := binary.LittleEndian.Uint32(data[section+16:])
+		rawOffset := binary.LittleEndian.Uint32(data[section+20:])
+
+		if virtualSize < rawSize {
+			virtualSize = rawSize
+		}
+
+		if rva >= virtualAddress && rva < virtualAddress+virtualSize {
+			return int(rva - virtualAddress + rawOffset), true
+		}
+	}
+	return 0, false
+}
+
+func (r *metadataReader) read() (*Metadata, error) {
+	if len(r.tables) < 24 {
+		return nil, errors.New("invalid metadata tables stream")
+	}
+
+	heapSizes := r.tables[6]
+	valid := binary.LittleEndian.Uint64(r.tables[8:])
+
+	r.stringSize, r.guidSize, r.blobSize = 2, 2, 2
+	if heapSizes&0x01 != 0 {
+		r.stringSize = 4
+	}
+	if heapSizes&0x02 != 0 {
+		r.guidSize = 4
+	}
+	if heapSizes&0x04 != 0 {
+		r.blobSize = 4
+	}
+
+	offset := 24
+	for i := 0; i < tableCount; i++ {
+		if valid&(1<<uint(i)) == 0 {
+			continue
+		}
+		if offset+4 > len(r.tables) {
+			return nil, errors.New("invalid metadata table row counts")
+		}
+		r.rows[i] = int(binary.LittleEndian.Uint32(r.tables[offset:]))
+		offset += 4
+	}
+
+	// 未压缩的#-流在行数之后还有4字节的额外数据
+	if heapSizes&0x40 != 0 {
+		offset += 4
+	}
+
+	rowSizes := r.rowSizes()
+
+	tableOffsets := [tableAssemblyRef + 1]int{}
+	for i := 0; i <= tableAssemblyRef; i++ {
+		tableOffsets[i] = offset
+		offset += rowSizes[i] * r.rows[i]
+	}
+
+	if offset > len(r.tables) {
+		return nil, errors.New("metadata tables are truncated")
+	}
+
+	metadata := &Metadata{References: make([]AssemblyIdentity, 0)}
+
+	if r.rows[tableAssembly] != 0 {
+		row := r.tables[tableOffsets[tableAssembly]:]
+		column := 4
+		version := r.version(row[column:])
+		column += 8 + 4
+		publicKey := r.readBlob(row, &column)
+		name := r.readString(row, &column)
+		culture := r.readString(row, &column)
+
+		metadata.Assembly = &AssemblyIdentity{
+			Name:           name,
+			Version:        version,
+			Culture:        cultureName(culture),
+			PublicKeyToken: publicKeyToken(publicKey, true),
+		}
+	}
+
+	for i := 0; i < r.rows[tableAssemblyRef]; i++ {
+		row := r.tables[tableOffsets[tableAssemblyRef]+i*rowSizes[tableAssemblyRef]:]
+		version := r.version(row)
+		column := 8
+		flags := binary.LittleEndian.Uint32(row[column:])
+		column += 4
+		publicKey := r.readBlob(row, &column)
+		name := r.readString(row, &column)
+		culture := r.readString(row, &column)
+
+		metadata.References = append(metadata.References, AssemblyIdentity{
+			Name:           name,
+			Version:        version,
+			Culture:        cultureName(culture),
+			PublicKeyToken: publicKeyToken(publicKey, flags&assemblyRefFlagPublicKey != 0),
+		})
+	}
+
+	return metadata, nil
+}
+
+// rowSizes 计算Assembly及其之前所有表的行大小
+func (r *metadataReader) rowSizes() [tableAssemblyRef + 1]int {
+	s, g, b := r.stringSize, r.guidSize, r.blobSize
+	index := r.index
+	coded := r.codedIndex
+
+	return [tableAssemblyRef + 1]int{
+		tableModule:            2 + s + g + g + g,
+		tableTypeRef:           coded(resolutionScope) + s + s,
+		tableTypeDef:           4 + s + s + coded(typeDefOrRef) + index(tableField) + index(tableMethodDef),
+		tableFieldPtr:          index(tableField),
+		tableField:             2 + s + b,
+		tableMethodPtr:         index(tableMethodDef),
+		tableMethodDef:         4 + 2 + 2 + s + b + index(tableParam),
+		tableParamPtr:          index(tableParam),
+		tableParam:             2 + 2 + s,
+		tableInterfaceImpl:     index(tableTypeDef) + coded(typeDefOrRef),
+		tableMemberRef:         coded(memberRefParent) + s + b,
+		tableConstant:          2 + coded(hasConstant) + b,
+		tableCustomAttribute:   coded(hasCustomAttribute) + coded(customAttributeType) + b,
+		tableFieldMarshal:      coded(hasFieldMarshal) + b,
+		tableDeclSecurity:      2 + coded(hasDeclSecurity) + b,
+		tableClassLayout:       2 + 4 + index(tableTypeDef),
+		tableFieldLayout:       4 + index(tableField),
+		tableStandAloneSig:     b,
+		tableEventMap:          index(tableTypeDef) + index(tableEvent),
+		tableEventPtr:          index(tableEvent),
+		tableEvent:             2 + s + coded(typeDefOrRef),
+		tablePropertyMap:       index(tableTypeDef) + index(tableProperty),
+		tablePropertyPtr:       index(tableProperty),
+		tableProperty:          2 + s + b,
+		tableMethodSemantics:   2 + index(tableMethodDef) + coded(hasSemantics),
+		tableMethodImpl:        index(tableTypeDef) + coded(methodDefOrRef) + coded(methodDefOrRef),
+		tableModuleRef:         s,
+		tableTypeSpec:          b,
+		tableImplMap:           2 + coded(memberForwarded) + s + index(tableModuleRef),
+		tableFieldRVA:          4 + index(tableField),
+		tableEncLog:            4 + 4,
+		tableEncMap:            4,
+		tableAssembly:          4 + 8 + 4 + b + s + s,
+		tableAssemblyProcessor: 4,
+		tableAssemblyOS:        4 + 4 + 4,
+		tableAssemblyRef:       8 + 4 + b + s + s + b,
+	}
+}
+
+func (r *metadataReader) index(table int) int {
+	if r.rows[table] < 1<<16 {
+		return 2
+	}
+	return 4
+}
+
+func (r *metadataReader) codedIndex(tables []int) int {
+	bits := uint(0)
+	for 1<<bits < len(tables) {
+		bits++
+	}
+
+	maxRows := 0
+	for _, table := range tables {
+		if table != unused && r.rows[table] > maxRows {
+			maxRows = r.rows[table]
+		}
+	}
+
+	if maxRows < 1<<(16-bits) {
+		return 2
+	}
+	return 4
+}
+
+func (r *metadataReader) version(row []byte) string {
+	return fmt.Sprintf("%d.%d.%d.%d",
+		binary.LittleEndian.Uint16(row[0:]),
+		binary.LittleEndian.Uint16(row[2:]),
+		binary.LittleEndian.Uint16(row[4:]),
+		binary.LittleEndian.Uint16(row[6:]))
+}
+
+func (r *metadataReader) readIndex(row []byte, column *int, size int) int {
+	var index int
+	if size == 2 {
+		index = int(binary.LittleEndian.Uint16(row[*column:]))
+	} else {
+		index = int(binary.LittleEndian.Uint32(row[*column:]))
+	}
+	*column += size
+	return index
+}
+
+func (r *metadataReader) readString(row []byte, column *int) string {
+	index := r.readIndex(row, column, r.stringSize)
+	if index >= len(r.strings) {
+		return ""
+	}
+	end := index
+	for end < len(r.strings) && r.strings[end] != 0 {
+		end++
+	}
+	return string(r.strings[index:end])
+}
+
+func (r *metadataReader) readBlob(row []byte, column *int) []byte {
+	index := r.readIndex(row, column, r.blobSize)
+	if index >= len(r.blob) {
+		return nil
+	}
+
+	// 压缩的长度前缀（ECMA-335 II.24.2.4）
+	length, header := 0, 0
+	first := r.blob[index]
+	switch {
+	case first&0x80 == 0:
+		length, header = int(first), 1
+	case first&0xc0 == 0x80 && index+1 < len(r.blob):
+		length, header = int(first&0x3f)<<8|int(r.blob[index+1]), 2
+	case first&0xe0 == 0xc0 && index+3 < len(r.blob):
+		length, header = int(first&0x1f)<<24|int(r.blob[index+1])<<16|int(r.blob[index+2])<<8|int(r.blob[index+3]), 4
+	default:
+		return nil
+	}
+
+	start := index + header
+	if start+length > len(r.blob) {
+		return nil
+	}
+	return r.blob[start : start+length]
+}
+
+func cultureName(culture string) string {
+	if culture == "" {
+		return "neutral"
+	}
+	return culture
+}
+
+// publicKeyToken 公钥标记为公钥SHA1值的最后8个字节（倒序）
+func publicKeyToken(publicKey []byte, isFullKey bool) string {
+	if len(publicKey) == 0 {
+		return "null"
+	}
+
+	if !isFullKey {
+		return strings.ToLower(hex.EncodeToString(publicKey))
+	}
+
+	hash := sha1.Sum(publicKey)
+	token := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		token[i] = hash[len(hash)-1-i]
+	}
+
+	return hex.EncodeToString(token)
+}
+
+// CompareVersion 比较两个a.b.c.d格式的版本号
+func CompareVersion(a string, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+
+	for i := 0; i < 4; i++ {
+		var x, y int
+		if i < len(partsA) {
+			fmt.Sscanf(partsA[i], "%d", &x)
+		}
+		if i < len(partsB) {
+			fmt.Sscanf(partsB[i], "%d", &y)
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,132 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Windows PDB（MSF 7.00）的文件头
+var msfMagic = []byte("Microsoft C/C++ MSF 7.00\r\n\x1aDS\x00\x00\x00")
+
+// msfPdbInfoStream PDB信息流的编号，内容以Version、Signature、Age、GUID开头
+const msfPdbInfoStream = 1
+
+// PdbID PDB文件自身记录的标识，与引用它的PE中的CodeView记录一致时才是同一次编译的产物
+type PdbID struct {
+	GUID     string
+	Portable bool
+}
+
+// ReadPdbID 读取portable PDB（#Pdb流）或Windows PDB（PDB信息流）中的标识
+func ReadPdbID(data []byte) (*PdbID, error) {
+	if bytes.HasPrefix(data, msfMagic) {
+		return readMsfPdbID(data)
+	}
+
+	streams, err := metadataStreams(data)
+	if err != nil {
+		return nil, errors.New("not a PDB file")
+	}
+
+	// #Pdb流以20字节的PDB id开头：GUID + 时间戳
+	stream := streams["#Pdb"]
+	if len(stream) < 20 {
+		return nil, errors.New("invalid #Pdb stream")
+	}
+
+	return &PdbID{GUID: formatGUID(stream), Portable: true}, nil
+}
+
+// readMsfPdbID 按MSF的目录读取PDB信息流
+func readMsfPdbID(data []byte) (*PdbID, error) {
+	if len(data) < 56 {
+		return nil, errors.New("invalid MSF header")
+	}
+
+	blockSize := int(binary.LittleEndian.Uint32(data[32:]))
+	directorySize := int(binary.LittleEndian.Uint32(data[44:]))
+	blockMapAddr := int(binary.LittleEndian.Uint32(data[52:]))
+	if blockSize <= 0 || blockSize&(blockSize-1) != 0 {
+		return nil, errors.New("invalid MSF block size")
+	}
+
+	block := func(index int) []byte {
+		if index < 0 || (index+1)*blockSize > len(data) {
+			return nil
+		}
+		return data[index*blockSize : (index+1)*blockSize]
+	}
+
+	// 按块号列表拼接出流的内容
+	read := func(blocks []byte, size int) []byte {
+		content := make([]byte, 0, size)
+		for len(content) < size && len(blocks) >= 4 {
+			b := block(int(binary.LittleEndian.Uint32(blocks)))
+			if b == nil {
+				return nil
+			}
+			content = append(content, b...)
+			blocks = blocks[4:]
+		}
+		if len(content) < size {
+			return nil
+		}
+		return content[:size]
+	}
+
+	directoryBlocks := (directorySize + blockSize - 1) / blockSize
+	blockMap := block(blockMapAddr)
+	if blockMap == nil || directoryBlocks*4 > len(blockMap) {
+		return nil, errors.New("invalid MSF block map")
+	}
+
+	directory := read(blockMap, directorySize)
+	if len(directory) < 4 {
+		return nil, errors.New("invalid MSF directory")
+	}
+
+	streamCount := int(binary.LittleEndian.Uint32(directory))
+	if streamCount <= msfPdbInfoStream || 4+streamCount*4 > len(directory) {
+		return nil, errors.New("PDB info stream not found")
+	}
+
+	// 目录：流数量、各流大小、各流的块号列表
+	blocks := 4 + streamCount*4
+	for i := 0; i < msfPdbInfoStream; i++ {
+		size := binary.LittleEndian.Uint32(directory[4+i*4:])
+		// 已删除的流大小为0xffffffff，不占用块
+		if size == 0xffffffff {
+			continue
+		}
+		blocks += (int(size) + blockSize - 1) / blockSize * 4
+	}
+
+	infoSize := int(binary.LittleEndian.Uint32(directory[4+msfPdbInfoStream*4:]))
+	if infoSize < 28 || blocks > len(directory) {
+		return nil, errors.New("invalid PDB info stream")
+	}
+
+	info := read(directory[blocks:], 28)
+	if info == nil {
+		return nil, errors.New("invalid PDB info stream")
+	}
+
+	return &PdbID{GUID: formatGUID(info[12:])}, nil
+}
+
+// formatGUID 与符号服务器key中的GUID格式一致
+func formatGUID(guid []byte) string {
+	return fmt.Sprintf("%08x%04x%04x%x",
+		binary.LittleEndian.Uint32(guid[0:]),
+		binary.LittleEndian.Uint16(guid[4:]),
+		binary.LittleEndian.Uint16(guid[6:]),
+		guid[8:16])
+}
+
+// Matches PDB是否由CodeView记录引用
+// Windows PDB只比较GUID，PDB信息流中的Age与CodeView中的Age（来自DBI流）在增量链接后可能不同
+func (c *CodeView) Matches(id *PdbID) bool {
+	return c.Portable == id.Portable && c.GUID == id.GUID
+}
@@ -0,0 +1,118 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// fixture的CodeView记录中的GUID（文件中的字节序）
+const fixturePdbGUID = "4acccaab7c122544be391b93dd850544"
+
+func guidBytes(t *testing.T) []byte {
+	guid, err := hex.DecodeString(fixturePdbGUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return guid
+}
+
+// portablePdb 只包含#Pdb流的元数据根
+func portablePdb(guid []byte) []byte {
+	version := "PDB v1.0\x00\x00\x00\x00"
+	streamOffset := 16 + len(version) + 4 + 16
+
+	var buf bytes.Buffer
+	for _, v := range []interface{}{
+		uint32(metadataSignature), uint16(1), uint16(1), uint32(0), uint32(len(version)), []byte(version),
+		uint16(0), uint16(1),
+		uint32(streamOffset), uint32(32), []byte("#Pdb\x00\x00\x00\x00"),
+		guid, make([]byte, 16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+
+	return buf.Bytes()
+}
+
+// msfPdb 块大小为512的Windows PDB：超级块、块映射、目录、PDB信息流
+func msfPdb(guid []byte, age uint32) []byte {
+	const blockSize = 512
+	data := make([]byte, 4*blockSize)
+
+	copy(data, msfMagic)
+	binary.LittleEndian.PutUint32(data[32:], blockSize)
+	binary.LittleEndian.PutUint32(data[40:], 4)
+	binary.LittleEndian.PutUint32(data[44:], 20)
+	binary.LittleEndian.PutUint32(data[52:], 1)
+
+	// 块映射：目录位于块2
+	binary.LittleEndian.PutUint32(data[blockSize:], 2)
+
+	// 目录：2个流，流0为空，流1位于块3
+	directory := data[2*blockSize:]
+	binary.LittleEndian.PutUint32(directory[0:], 2)
+	binary.LittleEndian.PutUint32(directory[4:], 0)
+	binary.LittleEndian.PutUint32(directory[8:], 28)
+	binary.LittleEndian.PutUint32(directory[12:], 3)
+
+	info := data[3*blockSize:]
+	binary.LittleEndian.PutUint32(info[0:], 20000404)
+	binary.LittleEndian.PutUint32(info[8:], age)
+	copy(info[12:], guid)
+
+	return data
+}
+
+func TestReadPdbID(t *testing.T) {
+	codeView, err := ReadCodeView(readFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := guidBytes(t)
+	other[0]++
+
+	tests := []struct {
+		name     string
+		data     []byte
+		portable bool
+		matches  bool
+	}{
+		{"portable", portablePdb(guidBytes(t)), true, true},
+		{"stale portable", portablePdb(other), true, false},
+		{"windows", msfPdb(guidBytes(t), 3), false, false},
+	}
+
+	for _, test := range tests {
+		id, err := ReadPdbID(test.data)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+		if id.Portable != test.portable {
+			t.Errorf("%s: Portable = %v, want %v", test.name, id.Portable, test.portable)
+		}
+		if test.name != "stale portable" && id.GUID != codeView.GUID {
+			t.Errorf("%s: GUID = %s, want %s", test.name, id.GUID, codeView.GUID)
+		}
+		if codeView.Matches(id) != test.matches {
+			t.Errorf("%s: Matches = %v, want %v", test.name, !test.matches, test.matches)
+		}
+	}
+}
+
+func TestReadPdbIDInvalid(t *testing.T) {
+	truncated := msfPdb(guidBytes(t), 1)[:1024]
+
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"PE":        readFixture(t),
+		"truncated": truncated,
+	} {
+		if _, err := ReadPdbID(data); err == nil {
+			t.Errorf("%s: ReadPdbID succeeded, want error", name)
+		}
+	}
+}
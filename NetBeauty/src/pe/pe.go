@@ -0,0 +1,182 @@
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Windows子系统
+const (
+	SubsystemGUI     uint16 = 2
+	SubsystemConsole uint16 = 3
+)
+
+const (
+	optionalMagicPE32     uint16 = 0x10b
+	optionalMagicPE32Plus uint16 = 0x20b
+
+	// 以下偏移量均相对于可选头起始位置，PE32与PE32+一致
+	checkSumOffset  = 64
+	subsystemOffset = 68
+
+	// 数据目录位置，PE32与PE32+不同
+	dataDirectoryOffsetPE32     = 96
+	dataDirectoryOffsetPE32Plus = 112
+)
+
+// DirectoryEntryCOMDescriptor CLI头（COM描述符）所在的数据目录索引
+const DirectoryEntryCOMDescriptor = 14
+
+// DataDirectory 可选头中的数据目录
+type DataDirectory struct {
+	VirtualAddress uint32
+	Size           uint32
+}
+
+var errNotPE = errors.New("not a PE file")
+
+// Header PE头中需要读写的字段及其位置
+type Header struct {
+	Magic          uint16
+	Subsystem      uint16
+	CheckSum       uint32
+	DataDirectory  []DataDirectory
+	optionalOffset int
+	sectionOffset  int
+	sectionCount   int
+}
+
+// ReadHeader 解析PE头
+func ReadHeader(data []byte) (*Header, error) {
+	if len(data) < 0x40 || data[0] != 'M' || data[1] != 'Z' {
+		return nil, errNotPE
+	}
+
+	peOffset := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	if peOffset <= 0 || peOffset+24 > len(data) || string(data[peOffset:peOffset+4]) != "PE\x00\x00" {
+		return nil, errNotPE
+	}
+
+	optionalSize := int(binary.LittleEndian.Uint16(data[peOffset+20:]))
+	optionalOffset := peOffset + 24
+
+	if optionalSize < subsystemOffset+2 || optionalOffset+optionalSize > len(data) {
+		return nil, fmt.Errorf("invalid optional header size: %d", optionalSize)
+	}
+
+	magic := binary.LittleEndian.Uint16(data[optionalOffset:])
+	if magic != optionalMagicPE32 && magic != optionalMagicPE32Plus {
+		return nil, fmt.Errorf("unknown optional header magic: 0x%x", magic)
+	}
+
+	directoryOffset := dataDirectoryOffsetPE32
+	if magic == optionalMagicPE32Plus {
+		directoryOffset = dataDirectoryOffsetPE32Plus
+	}
+
+	// NumberOfRvaAndSizes紧挨在数据目录之前
+	dataDirectory := make([]DataDirectory, 0)
+	if directoryOffset <= optionalSize {
+		count := int(binary.LittleEndian.Uint32(data[optionalOffset+directoryOffset-4:]))
+		for i := 0; i < count && directoryOffset+8*(i+1) <= optionalSize; i++ {
+			entryOffset := optionalOffset + directoryOffset + 8*i
+			dataDirectory = append(dataDirectory, DataDirectory{
+				VirtualAddress: binary.LittleEndian.Uint32(data[entryOffset:]),
+				Size:           binary.LittleEndian.Uint32(data[entryOffset+4:]),
+			})
+		}
+	}
+
+	return &Header{
+		Magic:          magic,
+		Subsystem:      binary.LittleEndian.Uint16(data[optionalOffset+subsystemOffset:]),
+		CheckSum:       binary.LittleEndian.Uint32(data[optionalOffset+checkSumOffset:]),
+		DataDirectory:  dataDirectory,
+		optionalOffset: optionalOffset,
+		sectionOffset:  optionalOffset + optionalSize,
+		sectionCount:   int(binary.LittleEndian.Uint16(data[peOffset+6:])),
+	}, nil
+}
+
+// IsManaged 是否为托管程序集（存在CLI头），混合模式程序集同样视为托管程序集
+func (h *Header) IsManaged() bool {
+	if len(h.DataDirectory) <= DirectoryEntryCOMDescriptor {
+		return false
+	}
+	directory := h.DataDirectory[DirectoryEntryCOMDescriptor]
+	return directory.VirtualAddress != 0 && directory.Size != 0
+}
+
+// SetSubsystem 修改PE可选头中的子系统，所有修改完成后需调用UpdateCheckSum
+func SetSubsystem(data []byte, subsystem uint16) error {
+	header, err := ReadHeader(data)
+	if err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint16(data[header.optionalOffset+subsystemOffset:], subsystem)
+
+	return nil
+}
+
+// UpdateCheckSum 原文件带有校验和时重新计算，apphost默认不带校验和
+func UpdateCheckSum(data []byte) error {
+	header, err := ReadHeader(data)
+	if err != nil {
+		return err
+	}
+
+	if header.CheckSum != 0 {
+		sumOffset := header.optionalOffset + checkSumOffset
+		binary.LittleEndian.PutUint32(data[sumOffset:], CheckSum(data, sumOffset))
+	}
+
+	return nil
+}
+
+// CheckSum 计算PE校验和（与imagehlp!CheckSumMappedFile一致），计算时跳过校验和字段本身
+func CheckSum(data []byte, checkSumOffset int) uint32 {
+	var sum uint64
+
+	size := len(data)
+
+	for i := 0; i+1 < size; i += 2 {
+		if i == checkSumOffset || i == checkSumOffset+2 {
+			continue
+		}
+		sum += uint64(binary.LittleEndian.Uint16(data[i:]))
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+
+	if size%2 == 1 {
+		sum += uint64(data[size-1])
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+
+	sum = (sum & 0xffff) + (sum >> 16)
+
+	return uint32(sum) + uint32(size)
+}
+
+// SubsystemName 子系统名称，仅识别console与gui
+func SubsystemName(subsystem uint16) string {
+	switch subsystem {
+	case SubsystemGUI:
+		return "gui"
+	case SubsystemConsole:
+		return "console"
+	}
+	return fmt.Sprintf("unknown(%d)", subsystem)
+}
+
+// ParseSubsystem 根据名称取子系统
+func ParseSubsystem(name string) (uint16, bool) {
+	switch name {
+	case "gui":
+		return SubsystemGUI, true
+	case "console":
+		return SubsystemConsole, true
+	}
+	return 0, false
+}
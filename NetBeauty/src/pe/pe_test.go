@@ -0,0 +1,172 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// testdata/System.ValueTuple.dll 取自Microsoft.NETCore.App 8.0.20，带有校验和
+const fixture = "testdata/System.ValueTuple.dll"
+
+const fixtureCheckSum = 0x60e3
+
+func readFixture(t *testing.T) []byte {
+	data, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReadHeader(t *testing.T) {
+	header, err := ReadHeader(readFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Magic != optionalMagicPE32 {
+		t.Errorf("Magic = 0x%x, want 0x%x", header.Magic, optionalMagicPE32)
+	}
+	if header.Subsystem != SubsystemConsole {
+		t.Errorf("Subsystem = %d, want %d", header.Subsystem, SubsystemConsole)
+	}
+	if header.CheckSum != fixtureCheckSum {
+		t.Errorf("CheckSum = 0x%x, want 0x%x", header.CheckSum, fixtureCheckSum)
+	}
+	if !header.IsManaged() {
+		t.Error("IsManaged = false, want true")
+	}
+}
+
+func TestReadHeaderInvalid(t *testing.T) {
+	valid := readFixture(t)
+	peOffset := int(binary.LittleEndian.Uint32(valid[0x3c:]))
+
+	badSignature := append([]byte{}, valid...)
+	copy(badSignature[peOffset:], "NE\x00\x00")
+
+	badMagic := append([]byte{}, valid...)
+	binary.LittleEndian.PutUint16(badMagic[peOffset+24:], 0x107)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:0x20]},
+		{"no MZ", append([]byte("ZM"), valid[2:]...)},
+		{"bad PE signature", badSignature},
+		{"bad optional magic", badMagic},
+		{"truncated optional header", valid[:peOffset+40]},
+	}
+
+	for _, test := range tests {
+		if _, err := ReadHeader(test.data); err == nil {
+			t.Errorf("%s: ReadHeader succeeded, want error", test.name)
+		}
+	}
+}
+
+func TestCheckSum(t *testing.T) {
+	data := readFixture(t)
+	header, _ := ReadHeader(data)
+
+	if sum := CheckSum(data, header.optionalOffset+checkSumOffset); sum != fixtureCheckSum {
+		t.Errorf("CheckSum = 0x%x, want 0x%x", sum, fixtureCheckSum)
+	}
+
+	// 奇数长度时最后一个字节单独累加
+	odd := append(append([]byte{}, data...), 0x01)
+	if sum, want := CheckSum(odd, header.optionalOffset+checkSumOffset), uint32(fixtureCheckSum+2); sum != want {
+		t.Errorf("CheckSum(odd) = 0x%x, want 0x%x", sum, want)
+	}
+}
+
+func TestSetSubsystem(t *testing.T) {
+	original := readFixture(t)
+	data := append([]byte{}, original...)
+
+	if err := SetSubsystem(data, SubsystemGUI); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateCheckSum(data); err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := ReadHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Subsystem != SubsystemGUI {
+		t.Errorf("Subsystem = %d, want %d", header.Subsystem, SubsystemGUI)
+	}
+	if want := CheckSum(data, header.optionalOffset+checkSumOffset); header.CheckSum != want || want == fixtureCheckSum {
+		t.Errorf("CheckSum = 0x%x, want recomputed 0x%x", header.CheckSum, want)
+	}
+
+	// 改回console后与原文件完全一致
+	SetSubsystem(data, SubsystemConsole)
+	UpdateCheckSum(data)
+	if !bytes.Equal(data, original) {
+		t.Error("switching back to console does not restore the original file")
+	}
+}
+
+func TestUpdateCheckSumKeepsZero(t *testing.T) {
+	data := readFixture(t)
+	header, _ := ReadHeader(data)
+	binary.LittleEndian.PutUint32(data[header.optionalOffset+checkSumOffset:], 0)
+
+	SetSubsystem(data, SubsystemGUI)
+	if err := UpdateCheckSum(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if header, _ := ReadHeader(data); header.CheckSum != 0 {
+		t.Errorf("CheckSum = 0x%x, want 0", header.CheckSum)
+	}
+}
+
+func TestSetSubsystemNotPE(t *testing.T) {
+	if err := SetSubsystem([]byte("\x7fELF"), SubsystemGUI); err == nil {
+		t.Error("SetSubsystem succeeded on an ELF file")
+	}
+}
+
+func TestSubsystemName(t *testing.T) {
+	tests := []struct {
+		name      string
+		subsystem uint16
+		valid     bool
+	}{
+		{"gui", SubsystemGUI, true},
+		{"console", SubsystemConsole, true},
+		{"native", 0, false},
+	}
+
+	for _, test := range tests {
+		subsystem, ok := ParseSubsystem(test.name)
+		if ok != test.valid || subsystem != test.subsystem {
+			t.Errorf("ParseSubsystem(%q) = %d, %v", test.name, subsystem, ok)
+		}
+		if ok && SubsystemName(subsystem) != test.name {
+			t.Errorf("SubsystemName(%d) = %q, want %q", subsystem, SubsystemName(subsystem), test.name)
+		}
+	}
+}
+
+func TestReadFileVersion(t *testing.T) {
+	version, err := ReadFileVersion(readFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "8.0.2025.41914" {
+		t.Errorf("ReadFileVersion = %s, want 8.0.2025.41914", version)
+	}
+
+	if _, err := ReadFileVersion([]byte("\x7fELF")); err == nil {
+		t.Error("ReadFileVersion succeeded on an ELF file")
+	}
+}
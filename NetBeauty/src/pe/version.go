@@ -0,0 +1,88 @@
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// DirectoryEntryResource 资源目录
+const DirectoryEntryResource = 2
+
+const (
+	resourceTypeVersion = 16
+	// VS_FIXEDFILEINFO.dwSignature
+	fixedFileInfoSignature = 0xfeef04bd
+	// VS_VERSIONINFO中wLength、wValueLength、wType及"VS_VERSION_INFO\0"按4字节对齐后的长度
+	fixedFileInfoOffset = 40
+)
+
+// ReadFileVersion 读取版本资源（VS_FIXEDFILEINFO）中的文件版本，托管程序集中为AssemblyFileVersion
+func ReadFileVersion(data []byte) (string, error) {
+	header, err := ReadHeader(data)
+	if err != nil {
+		return "", err
+	}
+
+	if len(header.DataDirectory) <= DirectoryEntryResource || header.DataDirectory[DirectoryEntryResource].VirtualAddress == 0 {
+		return "", errors.New("no resource directory")
+	}
+
+	root, ok := header.rvaToOffset(data, header.DataDirectory[DirectoryEntryResource].VirtualAddress)
+	if !ok {
+		return "", errors.New("invalid resource directory")
+	}
+
+	// 类型 => 名称 => 语言，名称及语言取第一项
+	offset := root
+	for level, id := range []int{resourceTypeVersion, -1, -1} {
+		if offset+16 > len(data) {
+			return "", errors.New("invalid resource directory")
+		}
+
+		named := int(binary.LittleEndian.Uint16(data[offset+12:]))
+		ids := int(binary.LittleEndian.Uint16(data[offset+14:]))
+
+		next := -1
+		for i := 0; i < named+ids; i++ {
+			entry := offset + 16 + 8*i
+			if entry+8 > len(data) {
+				break
+			}
+			if id == -1 || (i >= named && int(binary.LittleEndian.Uint32(data[entry:])) == id) {
+				next = int(binary.LittleEndian.Uint32(data[entry+4:]))
+				break
+			}
+		}
+		if next == -1 {
+			return "", errors.New("no version resource")
+		}
+
+		// 最高位表示子目录，最后一级为数据项
+		isDir := next&0x80000000 != 0
+		if isDir != (level < 2) {
+			return "", errors.New("invalid resource directory")
+		}
+		offset = root + next&0x7fffffff
+	}
+
+	if offset+8 > len(data) {
+		return "", errors.New("invalid resource data entry")
+	}
+
+	info, ok := header.rvaToOffset(data, binary.LittleEndian.Uint32(data[offset:]))
+	size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+	if !ok || size < fixedFileInfoOffset+16 || info+fixedFileInfoOffset+16 > len(data) {
+		return "", errors.New("invalid version resource")
+	}
+
+	fixed := data[info+fixedFileInfoOffset:]
+	if binary.LittleEndian.Uint32(fixed) != fixedFileInfoSignature {
+		return "", errors.New("invalid VS_FIXEDFILEINFO signature")
+	}
+
+	ms := binary.LittleEndian.Uint32(fixed[8:])
+	ls := binary.LittleEndian.Uint32(fixed[12:])
+
+	return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff), nil
+}
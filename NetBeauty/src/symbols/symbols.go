@@ -0,0 +1,357 @@
+package symbols
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/nulastudio/NetBeauty/src/log"
+	"github.com/nulastudio/NetBeauty/src/pe"
+	"github.com/nulastudio/NetBeauty/src/util"
+)
+
+// IndexFile 输出目录中的索引文件，每行为<key>\t<原始相对路径>
+const IndexFile = "index.txt"
+
+// 找不到key的符号文件按原始相对路径存放
+const unindexedDir = "unindexed"
+
+const (
+	loadCmdUUID  = 0x1b
+	ntGNUBuildID = 3
+)
+
+// Symbol 符号文件
+type Symbol struct {
+	// Source 原始文件或目录（dSYM）的相对路径
+	Source string
+	// File 实际的符号文件
+	File string
+	// Key 符号服务器（SSQP）中的key，为空时表示无法识别
+	Key string
+}
+
+// Collect 收集目录下所有的PDB及native调试文件，PDB的key由引用它的PE文件决定
+// PDB自身的标识与PE中的CodeView记录不一致时（旧的PDB）无法确定key
+func Collect(dir string) ([]Symbol, error) {
+	codeViews := make(map[string][]*pe.CodeView)
+	pdbs := make([]string, 0)
+	dbgs := make([]string, 0)
+	dSYMs := make([]string, 0)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.ToLower(info.Name())
+
+		if info.IsDir() {
+			if strings.HasSuffix(name, ".dsym") {
+				dSYMs = append(dSYMs, path)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case strings.HasSuffix(name, ".pdb"):
+			pdbs = append(pdbs, path)
+		case strings.HasSuffix(name, ".dbg") || strings.HasSuffix(name, ".debug"):
+			dbgs = append(dbgs, path)
+		case strings.HasSuffix(name, ".dll") || strings.HasSuffix(name, ".exe"):
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			if codeView, err := pe.ReadCodeView(content); err == nil {
+				// PDB与记录中的文件名一致，或与PE文件同名
+				base := info.Name()[:len(info.Name())-len(filepath.Ext(info.Name()))]
+				for _, pdb := range []string{codeView.PdbName(), base + ".pdb"} {
+					key := strings.ToLower(filepath.Join(filepath.Dir(path), pdb))
+					codeViews[key] = append(codeViews[key], codeView)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make([]Symbol, 0)
+
+	var add = func(source string, file string, key string) {
+		rel, _ := filepath.Rel(dir, source)
+		symbols = append(symbols, Symbol{Source: filepath.ToSlash(rel), File: file, Key: key})
+	}
+
+	for _, pdb := range pdbs {
+		key := ""
+		if id, err := pdbID(pdb); err == nil {
+			for _, codeView := range codeViews[strings.ToLower(pdb)] {
+				if codeView.Matches(id) {
+					key = codeView.SymbolKey()
+					break
+				}
+			}
+		}
+		add(pdb, pdb, key)
+	}
+
+	for _, dbg := range dbgs {
+		key := ""
+		if buildID, err := elfBuildID(dbg); err == nil {
+			key = "_.debug/elf-buildid-sym-" + buildID + "/_.debug"
+		}
+		add(dbg, dbg, key)
+	}
+
+	for _, dSYM := range dSYMs {
+		dwarfs, _ := filepath.Glob(filepath.Join(dSYM, "Contents", "Resources", "DWARF", "*"))
+		if len(dwarfs) == 0 {
+			add(dSYM, "", "")
+			continue
+		}
+		for _, dwarf := range dwarfs {
+			uuids, err := machoUUIDs(dwarf)
+			if err != nil || len(uuids) == 0 {
+				add(dSYM, dwarf, "")
+				continue
+			}
+			for _, uuid := range uuids {
+				add(dSYM, dwarf, "_.dwarf/mach-uuid-sym-"+uuid+"/_.dwarf")
+			}
+		}
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Source != symbols[j].Source {
+			return symbols[i].Source < symbols[j].Source
+		}
+		return symbols[i].Key < symbols[j].Key
+	})
+
+	return symbols, nil
+}
+
+// pdbID 读取PDB文件自身记录的标识
+func pdbID(file string) (*pe.PdbID, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return pe.ReadPdbID(content)
+}
+
+// elfBuildID 读取ELF的GNU build-id
+func elfBuildID(file string) (string, error) {
+	f, err := elf.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, section := range f.Sections {
+		if section.Type != elf.SHT_NOTE {
+			continue
+		}
+
+		data, err := section.Data()
+		if err != nil {
+			continue
+		}
+
+		for len(data) >= 12 {
+			nameSize := int(f.ByteOrder.Uint32(data[0:]))
+			descSize := int(f.ByteOrder.Uint32(data[4:]))
+			noteType := f.ByteOrder.Uint32(data[8:])
+
+			nameEnd := 12 + (nameSize+3)&^3
+			descEnd := nameEnd + (descSize+3)&^3
+			if descEnd > len(data) {
+				break
+			}
+
+			if noteType == ntGNUBuildID && nameSize == 4 && string(data[12:15]) == "GNU" {
+				return hex.EncodeToString(data[nameEnd : nameEnd+descSize]), nil
+			}
+
+			data = data[descEnd:]
+		}
+	}
+
+	return "", errors.New("no build-id")
+}
+
+// machoUUIDs 读取Mach-O（包括fat文件中每个架构）的LC_UUID
+func machoUUIDs(file string) ([]string, error) {
+	files := make([]*macho.File, 0)
+
+	if fat, err := macho.OpenFat(file); err == nil {
+		defer fat.Close()
+		for _, arch := range fat.Arches {
+			files = append(files, arch.File)
+		}
+	} else {
+		f, err := macho.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+
+	uuids := make([]string, 0)
+	for _, f := range files {
+		for _, load := range f.Loads {
+			raw := load.Raw()
+			if len(raw) >= 24 && f.ByteOrder.Uint32(raw) == loadCmdUUID {
+				uuids = append(uuids, hex.EncodeToString(raw[8:24]))
+			}
+		}
+	}
+
+	return uuids, nil
+}
+
+// storePath 符号文件在输出中的路径
+func (s Symbol) storePath() string {
+	if s.Key == "" {
+		return unindexedDir + "/" + s.Source
+	}
+	return s.Key
+}
+
+// Index 索引文件内容
+func Index(symbols []Symbol) []byte {
+	var buf bytes.Buffer
+	for _, symbol := range symbols {
+		fmt.Fprintf(&buf, "%s\t%s\n", symbol.storePath(), symbol.Source)
+	}
+	return buf.Bytes()
+}
+
+// Write 按SSQP结构写入到目录或zip（以.zip结尾）中，zip中的条目统一使用modTime
+func Write(dir string, symbols []Symbol, out string, modTime time.Time) error {
+	if strings.HasSuffix(strings.ToLower(out), ".zip") {
+		return writeZip(dir, symbols, out, modTime)
+	}
+	return writeDir(dir, symbols, out)
+}
+
+// sourceFiles 符号的所有文件，dSYM中的DWARF以外的文件同样保留在unindexed中
+func (s Symbol) sourceFiles(dir string) map[string]string {
+	files := make(map[string]string)
+
+	if s.File != "" && s.Key != "" {
+		files[s.Key] = s.File
+		return files
+	}
+
+	root := filepath.Join(dir, filepath.FromSlash(s.Source))
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files[unindexedDir+"/"+filepath.ToSlash(rel)] = path
+		}
+		return nil
+	})
+
+	return files
+}
+
+func writeDir(dir string, symbols []Symbol, out string) error {
+	for _, symbol := range symbols {
+		for storePath, file := range symbol.sourceFiles(dir) {
+			if _, err := util.CopyFile(file, filepath.Join(out, filepath.FromSlash(storePath))); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(out, 0777); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(out, IndexFile), Index(symbols), 0666)
+}
+
+func writeZip(dir string, symbols []Symbol, out string, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0777); err != nil {
+		return err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+
+	written := make(map[string]bool)
+	for _, symbol := range symbols {
+		files := symbol.sourceFiles(dir)
+		storePaths := make([]string, 0, len(files))
+		for storePath := range files {
+			storePaths = append(storePaths, storePath)
+		}
+		sort.Strings(storePaths)
+
+		for _, storePath := range storePaths {
+			if written[storePath] {
+				continue
+			}
+			written[storePath] = true
+
+			header := &zip.FileHeader{Name: storePath, Method: zip.Deflate, Modified: modTime}
+
+			entry, err := w.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			src, err := os.Open(files[storePath])
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(entry, src)
+			src.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	entry, err := w.CreateHeader(&zip.FileHeader{Name: IndexFile, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(Index(symbols)); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// Remove 从输出中删除已收集的符号文件
+func Remove(dir string, symbols []Symbol) {
+	for _, symbol := range symbols {
+		path := filepath.Join(dir, filepath.FromSlash(symbol.Source))
+		if err := os.RemoveAll(path); err != nil {
+			log.LogError(fmt.Errorf("remove symbol failed: %s : %s", path, err.Error()), false)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package symbols
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ../pe/testdata/System.ValueTuple.dll引用的portable PDB
+const (
+	fixture    = "../pe/testdata/System.ValueTuple.dll"
+	fixtureKey = "system.valuetuple.pdb/abcacc4a127c4425be391b93dd850544ffffffff/system.valuetuple.pdb"
+)
+
+// portablePdb 只包含#Pdb流的元数据根，guid为文件中的字节序
+func portablePdb(t *testing.T, guid string) []byte {
+	id, err := hex.DecodeString(guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version := "PDB v1.0\x00\x00\x00\x00"
+
+	var buf bytes.Buffer
+	for _, v := range []interface{}{
+		uint32(0x424a5342), uint16(1), uint16(1), uint32(0), uint32(len(version)), []byte(version),
+		uint16(0), uint16(1),
+		uint32(16 + len(version) + 4 + 16), uint32(32), []byte("#Pdb\x00\x00\x00\x00"),
+		id, make([]byte, 16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+
+	return buf.Bytes()
+}
+
+func setup(t *testing.T, pdb []byte) string {
+	dir, err := ioutil.TempDir("", "nbeauty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dll, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "System.ValueTuple.dll"), dll, 0666)
+	ioutil.WriteFile(filepath.Join(dir, "System.ValueTuple.pdb"), pdb, 0666)
+
+	return dir
+}
+
+func TestCollect(t *testing.T) {
+	tests := []struct {
+		name string
+		guid string
+		key  string
+	}{
+		{"matching", "4acccaab7c122544be391b93dd850544", fixtureKey},
+		// 与PE不是同一次编译的PDB不能使用PE中的key
+		{"stale", "00000000000000000000000000000000", ""},
+	}
+
+	for _, test := range tests {
+		dir := setup(t, portablePdb(t, test.guid))
+		defer os.RemoveAll(dir)
+
+		symbols, err := Collect(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(symbols) != 1 || symbols[0].Source != "System.ValueTuple.pdb" {
+			t.Fatalf("%s: Collect = %+v", test.name, symbols)
+		}
+		if symbols[0].Key != test.key {
+			t.Errorf("%s: Key = %q, want %q", test.name, symbols[0].Key, test.key)
+		}
+	}
+}
+
+func TestWriteZipDeterministic(t *testing.T) {
+	dir := setup(t, portablePdb(t, "4acccaab7c122544be391b93dd850544"))
+	defer os.RemoveAll(dir)
+
+	symbols, err := Collect(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	pdb := filepath.Join(dir, "System.ValueTuple.pdb")
+
+	archives := make([][]byte, 0)
+	for i, mtime := range []time.Time{time.Now(), time.Now().Add(-time.Hour)} {
+		os.Chtimes(pdb, mtime, mtime)
+
+		out := filepath.Join(dir, "out", string(rune('a'+i))+".zip")
+		if err := Write(dir, symbols, out, modTime); err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, content)
+	}
+
+	if !bytes.Equal(archives[0], archives[1]) {
+		t.Error("archives differ when only the file modification time changes")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 func PathExists(path string) bool {
@@ -23,6 +25,7 @@ func EnsureDirExists(dir string, perm os.FileMode) bool {
 	}
 }
 
+// CopyFile 复制文件，保留权限及修改时间
 func CopyFile(src string, des string) (written int64, err error) {
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -30,21 +33,66 @@ func CopyFile(src string, des string) (written int64, err error) {
 	}
 	defer srcFile.Close()
 
-	fi, _ := srcFile.Stat()
-	perm := fi.Mode()
+	fi, err := srcFile.Stat()
+	if err != nil {
+		return 0, err
+	}
 
 	dir := filepath.Dir(des)
-	if !EnsureDirExists(dir, 0777) {
+	if !PathExists(dir) && os.MkdirAll(dir, 0777) != nil {
 		return 0, errors.New("cannot create path: " + dir)
 	}
 
-	desFile, err := os.OpenFile(des, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+	// 目标可能是只读文件或指向其它文件的硬链接，先删除再写入
+	os.Remove(des)
+
+	desFile, err := os.OpenFile(des, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
 	if err != nil {
 		return 0, err
 	}
-	defer desFile.Close()
 
-	return io.Copy(desFile, srcFile)
+	if written, err = io.Copy(desFile, srcFile); err != nil {
+		desFile.Close()
+		return written, err
+	}
+	if err = desFile.Close(); err != nil {
+		return written, err
+	}
+
+	return written, os.Chtimes(des, fi.ModTime(), fi.ModTime())
+}
+
+// SortedKeys 按字典序排列的键
+func SortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RemoveEmptyDirs 从dir开始逐级向上删除空目录，不删除root及root以外的目录
+func RemoveEmptyDirs(root string, dir string) {
+	root, _ = filepath.Abs(root)
+
+	for {
+		absDir, _ := filepath.Abs(dir)
+		rel, err := filepath.Rel(root, absDir)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return
+		}
+
+		if files, _ := ioutil.ReadDir(absDir); len(files) != 0 {
+			return
+		}
+
+		if os.Remove(absDir) != nil {
+			return
+		}
+
+		dir = filepath.Dir(absDir)
+	}
 }
 
 func ReadAllDir(dir string) (paths []string, err error) {